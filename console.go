@@ -108,6 +108,9 @@ func (t *ConsoleTarget) Open(io.Writer) error {
 // Process writes a log message using Writer.
 func (t *ConsoleTarget) Process(e *Entry) {
 	if e == nil {
+		if t.DoingDetails {
+			t.CloseLogDetailsBlock("")
+		}
 		t.close <- true
 		return
 	}
@@ -115,9 +118,18 @@ func (t *ConsoleTarget) Process(e *Entry) {
 		return
 	}
 	msg := e.String()
+	if t.DoingDetails {
+		t.noteLevel(e.Level)
+		msg = indentLine(" - ", msg)
+	}
+	t.writeLine(msg, e.Level)
+}
+
+// writeLine writes a line, in the color of the level if ColorMode.
+func (t *ConsoleTarget) writeLine(msg string, lvl LU.Level) {
 	if t.ColorMode {
 		if !S.Contains(msg, "\033[") {
-			brush, ok := CtlSeqTextBrushes[e.Level]
+			brush, ok := CtlSeqTextBrushes[lvl]
 			if ok {
 				msg = brush(msg)
 			}
@@ -139,10 +151,12 @@ func (t *ConsoleTarget) DoesDetails() bool {
 	return true
 }
 
-func (t *ConsoleTarget) StartDetailsBlock(*Entry) {
-	fmt.Fprintln(t.Writer, "NOT IMPLEMENTED YET: ConsoleTarget.StartDetailsBlock")
+// StartDetailsBlock starts a set of log details in the current Category.
+func (t *ConsoleTarget) StartDetailsBlock(e *Entry) {
+	t.StartLogDetailsBlock(t.Category, e)
 }
 
-func (t *ConsoleTarget) CloseDetailsBlock(string) {
-	fmt.Fprintln(t.Writer, "NOT IMPLEMENTED YET: ConsoleTarget.CloseDetailsBlock")
+// CloseDetailsBlock is the same as CloseLogDetailsBlock.
+func (t *ConsoleTarget) CloseDetailsBlock(s string) {
+	t.CloseLogDetailsBlock(s)
 }
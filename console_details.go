@@ -1,20 +1,63 @@
 package log
 
-import LU "github.com/fbaube/logutils"
+import (
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	S "strings"
+)
 
+// StartLogDetailsBlock writes the entry as a normal log line, and then
+// starts a set of log details, which are written as indented " - " list
+// lines until CloseLogDetailsBlock. An open set is closed first.
 func (t *ConsoleTarget) StartLogDetailsBlock(sCatg string, E *Entry) {
+	if t.DoingDetails {
+		t.CloseLogDetailsBlock("")
+	}
 	t.Process(E)
-	di := t.DetailsInfo
-	di.DoingDetails = true
-	di.MinLogLevel = LU.LevelOkay
-	di.Category = sCatg
-	di.Subcategory = ""
+	t.startDetails(sCatg)
 }
 
+// CloseLogDetailsBlock ends the set of log details with a summary line
+// that has the emoji and color of the most severe level in the set.
 func (t *ConsoleTarget) CloseLogDetailsBlock(s string) {
-
+	if !t.DoingDetails {
+		return
+	}
+	t.DoingDetails = false
+	if s == "" {
+		s = "(end of details)"
+	}
+	t.writeLine(" = "+LU.EmojiOfLevel(t.MinLogLevel)+" "+s, t.MinLogLevel)
 }
 
+// LogTextQuote writes the entry (as a list line if in a set of log
+// details), followed by the lines of text, each quoted with " \" "
+// and not colored.
 func (t *ConsoleTarget) LogTextQuote(E *Entry, s string) {
+	if !t.Allow(E) {
+		return
+	}
+	t.Process(E)
+	s = S.TrimSuffix(s, "\n")
+	for _, line := range S.Split(s, "\n") {
+		fmt.Fprintln(t.Writer, ` " `+line)
+	}
+}
+
+// indentLine provides visual indenting by replacing the first three
+// characters of the message (i.e. of the timestamp) with the prefix.
+func indentLine(prefix, msg string) string {
+	if len(msg) > 3 && isASCII(msg[:3]) {
+		return prefix + msg[3:]
+	}
+	return prefix + msg
+}
 
+func isASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= 0x80 {
+			return false
+		}
+	}
+	return true
 }
@@ -8,6 +8,7 @@ import (
 	"strings"
 	"testing"
 
+	LU "github.com/fbaube/logutils"
 	log "github.com/fbaube/mlog"
 )
 
@@ -71,3 +72,34 @@ func TestConsoleTarget(t *testing.T) {
 		t.Errorf("Expected %q not found", "t2: 3")
 	}
 }
+
+func TestConsoleTargetDetails(t *testing.T) {
+	target := log.NewConsoleTarget()
+	writer := &MemoryWriter{}
+	target.Writer = writer
+	target.ColorMode = false
+	target.Open(writer)
+
+	entry := func(lvl LU.Level, msg string) *log.Entry {
+		return &log.Entry{Level: lvl, Message: msg, FormattedMessage: "15.04.05 " + msg}
+	}
+	target.StartLogDetailsBlock("[01]", entry(LU.LevelInfo, "t1"))
+	target.Process(entry(LU.LevelWarning, "t2"))
+	target.LogTextQuote(entry(LU.LevelInfo, "t3"), "q1\nq2\n")
+	target.CloseLogDetailsBlock("t4")
+	target.Process(entry(LU.LevelInfo, "t5"))
+
+	if target.DoingDetails || target.MinLogLevel != LU.LevelWarning {
+		t.Errorf("MinLogLevel = %v, expected %v", target.MinLogLevel, LU.LevelWarning)
+	}
+	expected := "15.04.05 t1\n" +
+		" - 04.05 t2\n" +
+		" - 04.05 t3\n" +
+		" \" q1\n" +
+		" \" q2\n" +
+		" = " + LU.EmojiOfLevel(LU.LevelWarning) + " t4\n" +
+		"15.04.05 t5\n"
+	if string(writer.bytes) != expected {
+		t.Errorf("output = %q, expected %q", writer.bytes, expected)
+	}
+}
@@ -5,11 +5,14 @@
 package log
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	LU "github.com/fbaube/logutils"
 	"io"
 	"os"
+	"sync"
+	"time"
 )
 
 // FileTarget writes filtered log messages to a file.
@@ -27,9 +30,56 @@ type FileTarget struct {
 	// maximum number of bytes allowed for a log file. Zero means no limit.
 	// This field is ignored when Rotate is false.
 	MaxBytes int64
+	// when to rotate at a specific time interval: "hourly", "daily",
+	// "weekly", or a cron-like "@every <duration>" (e.g. "@every 15m"),
+	// counted from midnight. Such backups are date-stamped rather than
+	// numbered, e.g. app.log.2026-10-16, and BackupCount applies to them
+	// separately. Empty means no time rotation.
+	// This field is ignored when Rotate is false.
+	RotateWhen string
+	// maximum age of backup files, which are removed on rotation once
+	// they are older. Zero means no limit.
+	// This field is ignored when Rotate is false.
+	MaxAge time.Duration
+	// whether to gzip backup files (e.g. app.log.1.gz) in the background
+	// after they are rotated. This field is ignored when Rotate is false.
+	Compress bool
+	// the size of the write buffer. Zero means that every message is
+	// written to the file at once.
+	WriteBufferSize int
+	// how often buffered messages are written to the file. Zero means
+	// only when the buffer is full, or on Flush or Close.
+	FlushInterval time.Duration
+	// messages of this level or more severe (e.g. LU.LevelError) are
+	// written and fsync'ed to disk at once. Zero means never.
+	SyncLevel LU.Level
+	// whether other processes write to (and rotate) the same log file.
+	// If so, an advisory lock on FileName + ".lock" is held around each
+	// write and rotation, a log file that another process has rotated is
+	// reopened rather than rotated again, and every message is written at
+	// once (i.e. WriteBufferSize and FlushInterval are ignored). It is
+	// supported only on Unix-like systems.
+	MultiProcess bool
+	// how often to check (with stat) that FileName is still the log
+	// file, and if it was moved or removed (e.g. by logrotate), to open
+	// it again. Zero means never, but see Reopen. (If MultiProcess, it
+	// is checked before every write anyway.)
+	StatInterval time.Duration
+	// the formatter to use instead of the Logger's, e.g. JSONFormatter.
+	// If nil, the message as formatted by the Logger is written.
+	Formatter Formatter
 
+	mu           sync.Mutex // guards the file, for Flush
 	fd           *os.File
+	bw           *bufio.Writer // nil if WriteBufferSize is zero
+	stopFlushing chan bool
+	lockFd       *os.File  // if MultiProcess
+	lastStat     time.Time // see StatInterval
 	currentBytes int64
+	period       time.Duration // parsed from RotateWhen
+	periodStart  time.Time     // of the current log file
+	nextRotation time.Time     // when the current period ends
+	compressing  sync.WaitGroup
 	errWriter    io.Writer
 	close        chan bool
 
@@ -47,15 +97,17 @@ func (t *FileTarget) SetSubcategory(s string) {
 
 // NewFileTarget creates a FileTarget.
 // The new FileTarget takes these default options:
-// MaxLevel: LevelNotice, Rotate: true, BackupCount: 10, MaxBytes: 1 << 20
+// MaxLevel: LevelInfo, Rotate: true, BackupCount: 10, MaxBytes: 1 << 20,
+// FlushInterval: 1s (which applies only once WriteBufferSize is set)
 // After calling this, you must fill in the FileName field.
 func NewFileTarget() *FileTarget {
 	return &FileTarget{
-		Filter:      &Filter{MaxLevel: LU.LevelInfo},
-		Rotate:      true,
-		BackupCount: 10,
-		MaxBytes:    1 << 20, // 1MB
-		close:       make(chan bool, 0),
+		Filter:        &Filter{MaxLevel: LU.LevelInfo},
+		Rotate:        true,
+		BackupCount:   10,
+		MaxBytes:      1 << 20, // 1MB
+		FlushInterval: time.Second,
+		close:         make(chan bool, 0),
 	}
 }
 
@@ -65,21 +117,80 @@ func (t *FileTarget) Open(errWriter io.Writer) error {
 	if t.FileName == "" {
 		return errors.New("FileTarget.FileName must be set")
 	}
+	t.period = 0
 	if t.Rotate {
 		if t.BackupCount < 0 {
 			return errors.New("FileTarget.BackupCount must be no less than 0")
 		}
-		if t.MaxBytes <= 0 {
+		if t.MaxBytes < 0 {
 			return errors.New("FileTarget.MaxBytes must be no less than 0")
 		}
+		if t.MaxAge < 0 {
+			return errors.New("FileTarget.MaxAge must be no less than 0")
+		}
+		period, err := parseRotateWhen(t.RotateWhen)
+		if err != nil {
+			return err
+		}
+		if t.MaxBytes == 0 && period == 0 {
+			return errors.New("FileTarget.MaxBytes or FileTarget.RotateWhen must be set")
+		}
+		t.period = period
+	}
+	if t.WriteBufferSize < 0 {
+		return errors.New("FileTarget.WriteBufferSize must be no less than 0")
+	}
+	if t.FlushInterval < 0 {
+		return errors.New("FileTarget.FlushInterval must be no less than 0")
+	}
+	if t.StatInterval < 0 {
+		return errors.New("FileTarget.StatInterval must be no less than 0")
+	}
+
+	t.lockFd = nil
+	if t.MultiProcess {
+		lockFd, err := openLockFile(t.FileName + ".lock")
+		if err != nil {
+			return fmt.Errorf("FileTarget was unable to create a lock file: %v", err)
+		}
+		if err = lockFile(lockFd); err != nil {
+			lockFd.Close()
+			return err
+		}
+		unlockFile(lockFd)
+		t.lockFd = lockFd
 	}
 
 	fd, err := os.OpenFile(t.FileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
 	if err != nil {
+		if t.lockFd != nil {
+			t.lockFd.Close()
+		}
 		return fmt.Errorf("FileTarget was unable to create a log file: %v", err)
 	}
 	t.fd = fd
 	t.errWriter = errWriter
+	t.lastStat = time.Now()
+	t.currentBytes = 0
+	// An existing log file belongs to the period in which it was
+	// last written, so that it is rotated if that period is over.
+	started := time.Now()
+	if fi, err := fd.Stat(); err == nil && fi.Size() > 0 {
+		t.currentBytes = fi.Size()
+		started = fi.ModTime()
+	}
+	if t.period > 0 {
+		t.periodStart = t.startOfPeriod(started)
+		t.nextRotation = t.endOfPeriod(t.periodStart)
+	}
+	t.bw = nil
+	if t.WriteBufferSize > 0 && !t.MultiProcess {
+		t.bw = bufio.NewWriterSize(fd, t.WriteBufferSize)
+		if t.FlushInterval > 0 {
+			t.stopFlushing = make(chan bool)
+			go t.flushPeriodically(t.stopFlushing)
+		}
+	}
 
 	return nil
 }
@@ -87,18 +198,114 @@ func (t *FileTarget) Open(errWriter io.Writer) error {
 // Process saves an allowed log message into the log file.
 func (t *FileTarget) Process(e *Entry) {
 	if e == nil {
-		t.fd.Close()
+		t.mu.Lock()
+		if t.stopFlushing != nil {
+			close(t.stopFlushing)
+			t.stopFlushing = nil
+		}
+		if t.fd != nil {
+			t.flushBuffer()
+			t.fd.Close()
+		}
+		if t.lockFd != nil {
+			t.lockFd.Close()
+		}
+		t.mu.Unlock()
+		t.compressing.Wait()
 		t.close <- true
 		return
 	}
-	if t.fd != nil && t.Allow(e) {
-		if t.Rotate {
-			t.rotate(int64(len(e.String()) + 1))
+	if !t.Allow(e) {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fd == nil {
+		return
+	}
+	msg := e.Format(t.Formatter)
+	if t.MultiProcess {
+		if err := lockFile(t.lockFd); err != nil {
+			fmt.Fprintf(t.errWriter, "FileTarget was unable to lock the log file: %v\n", err)
+		} else {
+			defer unlockFile(t.lockFd)
 		}
-		n, err := t.fd.Write([]byte(e.String() + "\n"))
-		t.currentBytes += int64(n)
-		if err != nil {
-			fmt.Fprintf(t.errWriter, "FileTarge write error: %v\n", err)
+		t.checkFile(time.Now())
+	} else if t.StatInterval > 0 && time.Since(t.lastStat) >= t.StatInterval {
+		t.checkFile(time.Now())
+	}
+	if t.fd == nil {
+		return
+	}
+	if t.Rotate {
+		if t.period > 0 && !e.Time.Before(t.nextRotation) {
+			t.rotateByTime(e.Time)
+		}
+		t.rotate(int64(len(msg) + 1))
+		if t.fd == nil {
+			return
+		}
+	}
+	t.write(msg + "\n")
+	if t.SyncLevel > 0 && e.Level <= t.SyncLevel {
+		t.syncToDisk()
+	}
+}
+
+// write writes to the buffer, or else straight to the file.
+// The caller must hold t.mu.
+func (t *FileTarget) write(s string) {
+	var n int
+	var err error
+	if t.bw != nil {
+		n, err = t.bw.WriteString(s)
+	} else {
+		n, err = t.fd.WriteString(s)
+	}
+	t.currentBytes += int64(n)
+	if err != nil {
+		fmt.Fprintf(t.errWriter, "FileTarge write error: %v\n", err)
+	}
+}
+
+// flushBuffer writes the buffered messages to the file.
+// The caller must hold t.mu.
+func (t *FileTarget) flushBuffer() {
+	if t.bw == nil || t.bw.Buffered() == 0 {
+		return
+	}
+	if err := t.bw.Flush(); err != nil {
+		fmt.Fprintf(t.errWriter, "FileTarget flush error: %v\n", err)
+		// Drop what cannot be written, so that a full disk
+		// does not make every later message fail too.
+		t.bw.Reset(t.fd)
+	}
+}
+
+// syncToDisk writes the buffered messages to the file and fsync's it.
+// The caller must hold t.mu.
+func (t *FileTarget) syncToDisk() {
+	t.flushBuffer()
+	if err := t.fd.Sync(); err != nil {
+		fmt.Fprintf(t.errWriter, "FileTarget sync error: %v\n", err)
+	}
+}
+
+// flushPeriodically writes the buffered messages to the
+// file every FlushInterval, until stop is closed.
+func (t *FileTarget) flushPeriodically(stop chan bool) {
+	ticker := time.NewTicker(t.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			t.mu.Lock()
+			if t.fd != nil {
+				t.flushBuffer()
+			}
+			t.mu.Unlock()
 		}
 	}
 }
@@ -108,9 +315,14 @@ func (t *FileTarget) Close() {
 	<-t.close
 }
 
-// Flush is a no-op but SHOULD have a call to flush the file.
+// Flush writes the buffered messages to the file,
+// and fsync's it, so that they are safely on disk.
 func (t *FileTarget) Flush() {
-	// t.fd.Flush()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fd != nil {
+		t.syncToDisk()
+	}
 }
 
 func (t *FileTarget) DoesDetails() bool {
@@ -118,39 +330,13 @@ func (t *FileTarget) DoesDetails() bool {
 }
 
 func (t *FileTarget) StartDetailsBlock(*Entry) {
-	fmt.Fprintln(t.fd, "NOT IMPLEMENTED YET: FileTarget.StartDetailsBlock")
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.write("NOT IMPLEMENTED YET: FileTarget.StartDetailsBlock\n")
 }
 
 func (t *FileTarget) CloseDetailsBlock(string) {
-	fmt.Fprintln(t.fd, "NOT IMPLEMENTED YET: FileTarget.CloseDetailsBlock")
-}
-
-func (t *FileTarget) rotate(bytes int64) {
-	if t.currentBytes+bytes <= t.MaxBytes || bytes > t.MaxBytes {
-		return
-	}
-	t.fd.Close()
-	t.currentBytes = 0
-
-	var err error
-	for i := t.BackupCount; i >= 0; i-- {
-		path := t.FileName
-		if i > 0 {
-			path = fmt.Sprintf("%v.%v", t.FileName, i)
-		}
-		if _, err = os.Lstat(path); err != nil {
-			// file not exists
-			continue
-		}
-		if i == t.BackupCount {
-			os.Remove(path)
-		} else {
-			os.Rename(path, fmt.Sprintf("%v.%v", t.FileName, i+1))
-		}
-	}
-	t.fd, err = os.OpenFile(t.FileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
-	if err != nil {
-		t.fd = nil
-		fmt.Fprintf(t.errWriter, "FileTarget was unable to create a log file: %v", err)
-	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.write("NOT IMPLEMENTED YET: FileTarget.CloseDetailsBlock\n")
 }
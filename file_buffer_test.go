@@ -0,0 +1,88 @@
+package log_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestFileTargetUnbuffered(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("FileTarget.Open(): %v", err)
+	}
+	// By default, every message is written to the file at once.
+	target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: "t1"})
+	if bytes, _ := os.ReadFile(logFile); string(bytes) != "t1\n" {
+		t.Errorf("contents = %q, expected %q", bytes, "t1\n")
+	}
+	go target.Process(nil)
+	target.Close()
+}
+
+func TestFileTargetBuffered(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	target.WriteBufferSize = 4096
+	target.FlushInterval = 0
+	target.SyncLevel = LU.LevelError
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("FileTarget.Open(): %v", err)
+	}
+	contents := func() string {
+		bytes, _ := os.ReadFile(logFile)
+		return string(bytes)
+	}
+
+	target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: "t1"})
+	if s := contents(); s != "" {
+		t.Errorf("buffered contents = %q, expected %q", s, "")
+	}
+	target.Flush()
+	if s := contents(); s != "t1\n" {
+		t.Errorf("flushed contents = %q, expected %q", s, "t1\n")
+	}
+	target.Process(&log.Entry{Level: LU.LevelError, FormattedMessage: "t2"})
+	if s := contents(); s != "t1\nt2\n" {
+		t.Errorf("synced contents = %q, expected %q", s, "t1\nt2\n")
+	}
+	target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: "t3"})
+	go target.Process(nil)
+	target.Close()
+	if s := contents(); s != "t1\nt2\nt3\n" {
+		t.Errorf("closed contents = %q, expected %q", s, "t1\nt2\nt3\n")
+	}
+}
+
+func TestFileTargetFlushInterval(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	target.WriteBufferSize = 4096
+	target.FlushInterval = 10 * time.Millisecond
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("FileTarget.Open(): %v", err)
+	}
+	target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: "t1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		bytes, _ := os.ReadFile(logFile)
+		if string(bytes) == "t1\n" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("contents = %q, expected %q", bytes, "t1\n")
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	go target.Process(nil)
+	target.Close()
+}
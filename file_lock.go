@@ -0,0 +1,10 @@
+package log
+
+import "os"
+
+// openLockFile opens (creating it if need be) the file
+// that MultiProcess FileTarget's take the lock on. The
+// log file itself is not locked, since it is renamed.
+func openLockFile(path string) (*os.File, error) {
+	return os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0660)
+}
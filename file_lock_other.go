@@ -0,0 +1,18 @@
+//go:build !unix
+
+package log
+
+import (
+	"errors"
+	"os"
+)
+
+var errNoFlock = errors.New("FileTarget.MultiProcess is not supported on this system")
+
+func lockFile(f *os.File) error {
+	return errNoFlock
+}
+
+func unlockFile(f *os.File) error {
+	return errNoFlock
+}
@@ -0,0 +1,100 @@
+//go:build unix
+
+package log_test
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestFileTargetMultiProcess(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	targets := make([]*log.FileTarget, 2)
+	for i := range targets {
+		targets[i] = log.NewFileTarget()
+		targets[i].FileName = logFile
+		targets[i].MaxBytes = 10
+		targets[i].MultiProcess = true
+		if err := targets[i].Open(os.Stderr); err != nil {
+			t.Fatalf("FileTarget.Open(): %v", err)
+		}
+	}
+	// Each file has room for three messages.
+	for i := 0; i < 12; i++ {
+		msg := fmt.Sprintf("%c%d", 'a'+i%2, i%10)
+		targets[i%2].Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: msg})
+	}
+	for _, target := range targets {
+		go target.Process(nil)
+		target.Close()
+	}
+
+	expected := map[string]string{
+		logFile + ".3": "a0\nb1\na2\n",
+		logFile + ".2": "b3\na4\nb5\n",
+		logFile + ".1": "a6\nb7\na8\n",
+		logFile:        "b9\na0\nb1\n",
+	}
+	for path, content := range expected {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if string(bytes) != content {
+			t.Errorf("%s = %q, expected %q", path, bytes, content)
+		}
+	}
+	if _, err := os.Stat(logFile + ".4"); err == nil {
+		t.Errorf("Found unexpected %s.4", logFile)
+	}
+}
+
+func TestFileTargetMultiProcessRotateByTime(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	os.WriteFile(logFile, []byte("old\n"), 0660)
+	twoHoursAgo := time.Now().Add(-2 * time.Hour)
+	os.Chtimes(logFile, twoHoursAgo, twoHoursAgo)
+
+	targets := make([]*log.FileTarget, 2)
+	for i := range targets {
+		targets[i] = log.NewFileTarget()
+		targets[i].FileName = logFile
+		targets[i].MaxBytes = 0
+		targets[i].RotateWhen = "hourly"
+		targets[i].MultiProcess = true
+		if err := targets[i].Open(os.Stderr); err != nil {
+			t.Fatalf("FileTarget.Open(): %v", err)
+		}
+	}
+	// a rotates the old file; b then reopens the new one, and must
+	// not rotate it again, since it was started in this period.
+	for i, msg := range []string{"a1", "b1"} {
+		targets[i].Process(&log.Entry{Level: LU.LevelInfo, Time: time.Now(), FormattedMessage: msg})
+	}
+	for _, target := range targets {
+		go target.Process(nil)
+		target.Close()
+	}
+
+	backup := logFile + "." + twoHoursAgo.Format("2006-01-02T15")
+	expected := map[string]string{
+		backup:  "old\n",
+		logFile: "a1\nb1\n",
+	}
+	for path, content := range expected {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if string(bytes) != content {
+			t.Errorf("%s = %q, expected %q", path, bytes, content)
+		}
+	}
+	if matches, _ := filepath.Glob(logFile + ".*.1"); len(matches) > 0 {
+		t.Errorf("Found unexpected %v", matches)
+	}
+}
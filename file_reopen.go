@@ -0,0 +1,130 @@
+package log
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// Reopener is a Target that can close and reopen its output, e.g.
+// a FileTarget after an external logrotate has moved its log file.
+type Reopener interface {
+	Reopen() error
+}
+
+// Reopen closes the log file and opens FileName again, e.g. after
+// an external logrotate has moved the log file. To do it in order
+// with the messages being logged, call coreLogger.Reopen instead.
+func (t *FileTarget) Reopen() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.fd != nil {
+		t.flushBuffer()
+		t.fd.Close()
+	}
+	t.reopen(time.Now())
+	if t.fd == nil {
+		return fmt.Errorf("FileTarget was unable to reopen %v", t.FileName)
+	}
+	return nil
+}
+
+// reopen opens FileName in place of a log file that has been closed.
+// As in Open, the file belongs to the period in which it was last
+// written (e.g. by another process that has just rotated it), or to
+// the current one if it is empty. The caller must hold t.mu.
+func (t *FileTarget) reopen(now time.Time) {
+	t.openFile()
+	if t.fd == nil {
+		return
+	}
+	t.lastStat = now
+	t.currentBytes = 0
+	started := now
+	if fi, err := t.fd.Stat(); err == nil && fi.Size() > 0 {
+		t.currentBytes = fi.Size()
+		started = fi.ModTime()
+	}
+	if t.period > 0 {
+		t.periodStart = t.startOfPeriod(started)
+		t.nextRotation = t.endOfPeriod(t.periodStart)
+	}
+}
+
+// checkFile reopens the log file if it is not the file at FileName
+// any more, i.e. if it has been moved or removed (by logrotate, or
+// by another process that rotated it), and updates currentBytes,
+// which then includes what other processes wrote.
+// The caller must hold t.mu (and if MultiProcess, the file lock).
+func (t *FileTarget) checkFile(now time.Time) {
+	t.lastStat = now
+	fi, err := t.fd.Stat()
+	if err != nil {
+		fmt.Fprintf(t.errWriter, "FileTarget was unable to stat the log file: %v\n", err)
+		return
+	}
+	if pfi, err := os.Stat(t.FileName); err != nil || !os.SameFile(fi, pfi) {
+		t.flushBuffer()
+		t.fd.Close()
+		t.reopen(now)
+		return
+	}
+	t.currentBytes = fi.Size()
+}
+
+// Reopen makes every Reopener target (such as a FileTarget) reopen
+// its output, in order with the messages logged before and after.
+func (l *coreLogger) Reopen() {
+	l.control(opReopen, "")
+}
+
+// ReopenOnSignal makes the logger Reopen its targets whenever the
+// process receives one of the signals, by default SIGHUP (which is
+// what logrotate is usually configured to send). It lasts until
+// StopReopenOnSignal is called, also across Close and Open, so that
+// the signal does not kill the process (its default action) while
+// the logger is closed; meanwhile the signals are ignored.
+func (l *coreLogger) ReopenOnSignal(sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGHUP}
+	}
+	l.sigLock.Lock()
+	defer l.sigLock.Unlock()
+	if l.sigChan == nil {
+		l.sigChan = make(chan os.Signal, 1)
+		l.sigStop = make(chan bool)
+		go func(c chan os.Signal, stop chan bool) {
+			for {
+				select {
+				case <-c:
+					// unless stopped meanwhile; not under sigLock,
+					// as Reopen can wait for a stuck target
+					l.sigLock.Lock()
+					stopped := l.sigStop != stop
+					l.sigLock.Unlock()
+					if !stopped {
+						l.Reopen()
+					}
+				case <-stop:
+					return
+				}
+			}
+		}(l.sigChan, l.sigStop)
+	}
+	signal.Notify(l.sigChan, sigs...)
+}
+
+// StopReopenOnSignal undoes ReopenOnSignal.
+func (l *coreLogger) StopReopenOnSignal() {
+	l.sigLock.Lock()
+	defer l.sigLock.Unlock()
+	if l.sigChan == nil {
+		return
+	}
+	signal.Stop(l.sigChan)
+	close(l.sigStop)
+	l.sigChan = nil
+	l.sigStop = nil
+}
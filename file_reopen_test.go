@@ -0,0 +1,169 @@
+package log_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestLoggerReopen(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+
+	logger := log.NewLogger()
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	logger.Targets = append(logger.Targets, target)
+	logger = logger.GetLogger("", func(l *log.Logger, e *log.Entry) string {
+		return e.Message
+	})
+	logger.Open()
+	logger.Info("t1")
+	logger.Flush()
+	// as logrotate would do
+	os.Rename(logFile, logFile+".old")
+	logger.Info("t2")
+	logger.Reopen()
+	logger.Info("t3")
+	waitForFile(logFile)
+	logger.ReopenOnSignal()
+	defer logger.StopReopenOnSignal()
+	os.Rename(logFile, logFile+".old2")
+	if p, err := os.FindProcess(os.Getpid()); err != nil || p.Signal(syscall.SIGHUP) != nil {
+		t.Skip("cannot send SIGHUP")
+	}
+	waitForFile(logFile)
+	logger.Info("t4")
+	logger.Close()
+
+	expected := map[string]string{
+		logFile + ".old":  "t1\nt2\n",
+		logFile + ".old2": "t3\n",
+		logFile:           "t4\n",
+	}
+	for path, content := range expected {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if string(bytes) != content {
+			t.Errorf("%s = %q, expected %q", path, bytes, content)
+		}
+	}
+}
+
+func TestReopenOnSignalAfterClose(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	logger := log.NewLogger()
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	logger.Targets = append(logger.Targets, target)
+	logger = logger.GetLogger("", func(l *log.Logger, e *log.Entry) string {
+		return e.Message
+	})
+	logger.Open()
+	logger.ReopenOnSignal()
+	defer logger.StopReopenOnSignal()
+	logger.Close()
+	p, err := os.FindProcess(os.Getpid())
+	if err != nil || p.Signal(syscall.SIGHUP) != nil {
+		t.Skip("cannot send SIGHUP")
+	}
+	time.Sleep(10 * time.Millisecond) // ignored, as the logger is closed
+
+	logger.Open()
+	logger.Info("t1")
+	logger.Flush()
+	os.Rename(logFile, logFile+".old")
+	p.Signal(syscall.SIGHUP)
+	waitForFile(logFile)
+	logger.Info("t2")
+	logger.Close()
+
+	expected := map[string]string{
+		logFile + ".old": "t1\n",
+		logFile:          "t2\n",
+	}
+	for path, content := range expected {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if string(bytes) != content {
+			t.Errorf("%s = %q, expected %q", path, bytes, content)
+		}
+	}
+}
+
+func TestReopenOnSignalWithStuckTarget(t *testing.T) {
+	logger := log.NewLogger()
+	logger.BufferSize = 1
+	slow := NewSlowTarget(true)
+	logger.Targets = append(logger.Targets, slow)
+	logger.Open()
+	logger.ReopenOnSignal()
+	logger.Info("t1")
+	<-slow.entered // t1 is being processed
+	logger.Info("t2")
+	go logger.Info("t3") // waits for room in the full queue
+	time.Sleep(10 * time.Millisecond)
+	if p, err := os.FindProcess(os.Getpid()); err != nil || p.Signal(syscall.SIGHUP) != nil {
+		t.Skip("cannot send SIGHUP")
+	}
+	time.Sleep(10 * time.Millisecond) // Reopen waits for t3
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	returned := make(chan error)
+	go func() {
+		logger.StopReopenOnSignal()
+		returned <- logger.CloseContext(ctx)
+	}()
+	select {
+	case err := <-returned:
+		if err != context.DeadlineExceeded {
+			t.Errorf("CloseContext() = %v, expected %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("StopReopenOnSignal() or CloseContext() waited for the stuck target")
+	}
+	close(slow.release)
+	logger.Close()
+}
+
+// waitForFile waits (for a while) until a file exists.
+func waitForFile(path string) {
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); {
+		if _, err := os.Stat(path); err == nil {
+			return
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestFileTargetStatInterval(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	target.StatInterval = time.Millisecond
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("FileTarget.Open(): %v", err)
+	}
+	target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: "t1"})
+	os.Remove(logFile)
+	time.Sleep(2 * time.Millisecond)
+	target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: "t2"})
+	go target.Process(nil)
+	target.Close()
+
+	bytes, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(bytes) != "t2\n" {
+		t.Errorf("contents = %q, expected %q", bytes, "t2\n")
+	}
+}
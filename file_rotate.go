@@ -0,0 +1,259 @@
+package log
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	S "strings"
+	"time"
+)
+
+const (
+	day  = 24 * time.Hour
+	week = 7 * day
+)
+
+// parseRotateWhen parses FileTarget.RotateWhen into a rotation period.
+// "hourly", "daily" and "weekly" can also be written as the cron aliases
+// "@hourly", "@daily" (or "@midnight") and "@weekly". An "@every" period
+// of a day or more must be a whole number of days.
+func parseRotateWhen(when string) (time.Duration, error) {
+	switch S.TrimPrefix(S.ToLower(S.TrimSpace(when)), "@") {
+	case "":
+		return 0, nil
+	case "hourly":
+		return time.Hour, nil
+	case "daily", "midnight":
+		return day, nil
+	case "weekly":
+		return week, nil
+	}
+	s, ok := S.CutPrefix(S.TrimSpace(when), "@every ")
+	if !ok {
+		return 0, fmt.Errorf("FileTarget.RotateWhen is invalid: %q", when)
+	}
+	d, err := time.ParseDuration(S.TrimSpace(s))
+	if err != nil || d < time.Second || (d > day && d%day != 0) {
+		return 0, fmt.Errorf("FileTarget.RotateWhen is invalid: %q", when)
+	}
+	return d, nil
+}
+
+// startOfPeriod returns the start of the rotation period that contains
+// tm. Periods are counted from local midnight; weeks start on Sunday.
+func (t *FileTarget) startOfPeriod(tm time.Time) time.Time {
+	midnight := time.Date(tm.Year(), tm.Month(), tm.Day(), 0, 0, 0, 0, tm.Location())
+	switch {
+	case t.period == week:
+		return midnight.AddDate(0, 0, -int(midnight.Weekday()))
+	case t.period >= day:
+		return midnight
+	}
+	return midnight.Add(tm.Sub(midnight) / t.period * t.period)
+}
+
+// endOfPeriod returns the start of the next rotation period. Whole days
+// are added by the calendar, so that DST changes do not shift them.
+func (t *FileTarget) endOfPeriod(start time.Time) time.Time {
+	if t.period >= day {
+		return start.AddDate(0, 0, int(t.period/day))
+	}
+	return start.Add(t.period)
+}
+
+// stampLayout is the time layout of date-stamped backup names,
+// precise enough to tell apart the periods.
+func (t *FileTarget) stampLayout() string {
+	switch {
+	case t.period >= day:
+		return "2006-01-02"
+	case t.period >= time.Hour && t.period%time.Hour == 0:
+		return "2006-01-02T15"
+	case t.period >= time.Minute && t.period%time.Minute == 0:
+		return "2006-01-02T15-04"
+	}
+	return "2006-01-02T15-04-05"
+}
+
+// rotateByTime renames the log file to a backup name that is stamped
+// with the start of its period, and starts a new log file. An empty
+// log file is not rotated but just carries on into the new period.
+func (t *FileTarget) rotateByTime(now time.Time) {
+	if t.currentBytes == 0 {
+		t.periodStart = t.startOfPeriod(now)
+		t.nextRotation = t.endOfPeriod(t.periodStart)
+		return
+	}
+	t.flushBuffer()
+	t.fd.Close()
+	t.currentBytes = 0
+	t.compressing.Wait()
+
+	path := fmt.Sprintf("%v.%v", t.FileName, t.periodStart.Format(t.stampLayout()))
+	for i := 1; fileExists(path) || fileExists(path+".gz"); i++ {
+		// e.g. after a restart within the same period
+		path = fmt.Sprintf("%v.%v.%v", t.FileName, t.periodStart.Format(t.stampLayout()), i)
+	}
+	err := os.Rename(t.FileName, path)
+	if err != nil && !os.IsNotExist(err) {
+		fmt.Fprintf(t.errWriter, "FileTarget was unable to rotate the log file: %v\n", err)
+	}
+	t.periodStart = t.startOfPeriod(now)
+	t.nextRotation = t.endOfPeriod(t.periodStart)
+	t.removeOldBackups()
+	t.openFile()
+	if err == nil && t.Compress {
+		t.compress(path)
+	}
+}
+
+// rotate rotates the log file by size, shifting the numbered backups.
+func (t *FileTarget) rotate(bytes int64) {
+	if t.MaxBytes <= 0 || t.currentBytes+bytes <= t.MaxBytes || bytes > t.MaxBytes {
+		return
+	}
+	t.flushBuffer()
+	t.fd.Close()
+	t.currentBytes = 0
+	// A backup that is still being compressed cannot be shifted yet.
+	t.compressing.Wait()
+
+	var err error
+	for i := t.BackupCount; i >= 0; i-- {
+		path := t.FileName
+		if i > 0 {
+			path = fmt.Sprintf("%v.%v", t.FileName, i)
+		}
+		// A backup may or may not be compressed.
+		for _, ext := range []string{"", ".gz"} {
+			if i == 0 && ext != "" {
+				break
+			}
+			if _, err = os.Lstat(path + ext); err != nil {
+				// file not exists
+				continue
+			}
+			if i == t.BackupCount {
+				os.Remove(path + ext)
+			} else {
+				os.Rename(path+ext, fmt.Sprintf("%v.%v%v", t.FileName, i+1, ext))
+			}
+		}
+	}
+	t.removeOldBackups()
+	t.openFile()
+	if t.Compress && t.BackupCount > 0 {
+		t.compress(t.FileName + ".1")
+	}
+}
+
+// compress gzips a backup file in the background (unless MultiProcess),
+// replacing it with path + ".gz". A failure is reported thru errWriter,
+// and leaves the backup uncompressed.
+func (t *FileTarget) compress(path string) {
+	if t.MultiProcess {
+		// Another process could shift the backup while it is being
+		// compressed, so it is done at once, under the lock.
+		if err := gzipFile(path); err != nil {
+			fmt.Fprintf(t.errWriter, "FileTarget was unable to compress %v: %v\n", path, err)
+		}
+		return
+	}
+	t.compressing.Add(1)
+	go func() {
+		defer t.compressing.Done()
+		if err := gzipFile(path); err != nil {
+			fmt.Fprintf(t.errWriter, "FileTarget was unable to compress %v: %v\n", path, err)
+		}
+	}()
+}
+
+// gzipFile replaces a file with a gzipped copy that has the same
+// modification time, so that MaxAge still applies to it.
+func gzipFile(path string) error {
+	src, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	fi, err := src.Stat()
+	if err != nil {
+		src.Close()
+		return err
+	}
+	dst, err := os.OpenFile(path+".gz", os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0660)
+	if err != nil {
+		src.Close()
+		return err
+	}
+	zw := gzip.NewWriter(dst)
+	_, err = io.Copy(zw, src)
+	if err == nil {
+		err = zw.Close()
+	}
+	if cerr := dst.Close(); err == nil {
+		err = cerr
+	}
+	src.Close()
+	if err != nil {
+		os.Remove(path + ".gz")
+		return err
+	}
+	os.Chtimes(path+".gz", fi.ModTime(), fi.ModTime())
+	return os.Remove(path)
+}
+
+// openFile (re)opens the log file after a rotation.
+// The caller must hold t.mu.
+func (t *FileTarget) openFile() {
+	var err error
+	t.fd, err = os.OpenFile(t.FileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		t.fd = nil
+		fmt.Fprintf(t.errWriter, "FileTarget was unable to create a log file: %v", err)
+		return
+	}
+	if t.bw != nil {
+		t.bw.Reset(t.fd)
+	}
+}
+
+// removeOldBackups removes the date-stamped backups beyond BackupCount
+// (oldest first), and all backups that are older than MaxAge.
+func (t *FileTarget) removeOldBackups() {
+	dated := t.datedBackups()
+	if len(dated) > t.BackupCount {
+		for _, path := range dated[:len(dated)-t.BackupCount] {
+			os.Remove(path)
+		}
+		dated = dated[len(dated)-t.BackupCount:]
+	}
+	if t.MaxAge <= 0 {
+		return
+	}
+	cutoff := time.Now().Add(-t.MaxAge)
+	for i := 1; i <= t.BackupCount; i++ {
+		path := fmt.Sprintf("%v.%v", t.FileName, i)
+		dated = append(dated, path, path+".gz")
+	}
+	for _, path := range dated {
+		if fi, err := os.Lstat(path); err == nil && fi.ModTime().Before(cutoff) {
+			os.Remove(path)
+		}
+	}
+}
+
+// datedBackups returns the date-stamped backups (compressed
+// or not), oldest first.
+func (t *FileTarget) datedBackups() []string {
+	paths, _ := filepath.Glob(t.FileName + ".[0-9][0-9][0-9][0-9]-[0-9][0-9]-[0-9][0-9]*")
+	sort.Strings(paths)
+	return paths
+}
+
+func fileExists(path string) bool {
+	_, err := os.Lstat(path)
+	return err == nil
+}
@@ -0,0 +1,148 @@
+package log_test
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestFileTargetRotateByTime(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+	old := logFile + ".1"
+	os.WriteFile(old, []byte("old\n"), 0660)
+	tenDaysAgo := time.Now().AddDate(0, 0, -10)
+	os.Chtimes(old, tenDaysAgo, tenDaysAgo)
+
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	target.MaxBytes = 0
+	target.RotateWhen = "daily"
+	target.BackupCount = 2
+	target.MaxAge = 48 * time.Hour
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("FileTarget.Open(): %v", err)
+	}
+
+	now := time.Now()
+	tomorrow := time.Date(now.Year(), now.Month(), now.Day()+1, 10, 0, 0, 0, now.Location())
+	for _, d := range []int{0, 0, 1, 2, 3} {
+		tm := tomorrow.AddDate(0, 0, d)
+		msg := tm.Format("2006-01-02")
+		target.Process(&log.Entry{Level: LU.LevelInfo, Time: tm, FormattedMessage: msg})
+	}
+	go target.Process(nil)
+	target.Close()
+
+	stamp := func(d int) string {
+		return logFile + "." + tomorrow.AddDate(0, 0, d).Format("2006-01-02")
+	}
+	expected := map[string]string{
+		stamp(1): stamp(1)[len(logFile)+1:] + "\n",
+		stamp(2): stamp(2)[len(logFile)+1:] + "\n",
+		logFile:  stamp(3)[len(logFile)+1:] + "\n",
+	}
+	for path, content := range expected {
+		bytes, err := os.ReadFile(path)
+		if err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		} else if string(bytes) != content {
+			t.Errorf("%s = %q, expected %q", path, bytes, content)
+		}
+	}
+	for _, path := range []string{stamp(-1), stamp(0), old} {
+		if _, err := os.Stat(path); err == nil {
+			t.Errorf("Found unexpected %s", path)
+		}
+	}
+}
+
+func TestFileTargetRotateWhen(t *testing.T) {
+	tests := []struct {
+		when string
+		ok   bool
+	}{
+		{"hourly", true},
+		{"@daily", true},
+		{"weekly", true},
+		{"@every 15m", true},
+		{"@every 48h", true},
+		{"@every 36h", false},
+		{"monthly", false},
+	}
+	for _, test := range tests {
+		target := log.NewFileTarget()
+		target.FileName = filepath.Join(t.TempDir(), "app.log")
+		target.RotateWhen = test.when
+		err := target.Open(os.Stderr)
+		if (err == nil) != test.ok {
+			t.Errorf("RotateWhen %q: Open() = %v, expected ok = %v", test.when, err, test.ok)
+		}
+	}
+}
+
+func TestFileTargetCompress(t *testing.T) {
+	tests := []struct {
+		backupCount int
+		expected    map[string]string
+		failure     bool
+	}{
+		{3, map[string]string{".1.gz": "t3\n", ".2.gz": "t2\n", ".3.gz": "t1\n", "": "t4\n"}, false},
+		// a directory where app.log.1.gz would go makes its compression fail
+		{1, map[string]string{".1": "t3\n", "": "t4\n"}, true},
+	}
+	for _, test := range tests {
+		logFile := filepath.Join(t.TempDir(), "app.log")
+		if test.failure {
+			os.MkdirAll(filepath.Join(logFile+".1.gz", "x"), 0770)
+		}
+		target := log.NewFileTarget()
+		target.FileName = logFile
+		target.MaxBytes = 3
+		target.BackupCount = test.backupCount
+		target.Compress = true
+		errWriter := &MemoryWriter{}
+		if err := target.Open(errWriter); err != nil {
+			t.Fatalf("FileTarget.Open(): %v", err)
+		}
+		for _, msg := range []string{"t1", "t2", "t3", "t4"} {
+			target.Process(&log.Entry{Level: LU.LevelInfo, FormattedMessage: msg})
+		}
+		go target.Process(nil)
+		target.Close()
+
+		for ext, content := range test.expected {
+			s, err := readMaybeGzipped(logFile + ext)
+			if err != nil {
+				t.Errorf("Unexpected error: %v", err)
+			} else if s != content {
+				t.Errorf("%s%s = %q, expected %q", logFile, ext, s, content)
+			}
+		}
+		if failed := strings.Contains(string(errWriter.bytes), "unable to compress"); failed != test.failure {
+			t.Errorf("compression failure reported = %v, expected %v: %q", failed, test.failure, errWriter.bytes)
+		}
+	}
+}
+
+func readMaybeGzipped(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		if r, err = gzip.NewReader(f); err != nil {
+			return "", err
+		}
+	}
+	bytes, err := io.ReadAll(r)
+	return string(bytes), err
+}
@@ -50,3 +50,9 @@ func (t *Filter) Allow(e *Entry) bool {
 	}
 	return len(t.catNames) == 0 && len(t.catPrefixes) == 0
 }
+
+// filter returns the Filter itself. It is promoted to the targets
+// that embed a *Filter, so that LevelHandler can show their settings.
+func (t *Filter) filter() *Filter {
+	return t
+}
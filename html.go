@@ -1,13 +1,201 @@
 package log
 
-import "io"
+import (
+	"errors"
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	"html"
+	"io"
+	S "strings"
+)
 
+// HtmlLevelClasses maps log levels to the CSS classes of log lines
+// in HTML. It is the HtmlTarget counterpart of CtlSeqTextBrushes.
+var HtmlLevelClasses = map[LU.Level]string{
+	LU.LevelDebug:   "mlog-debug",
+	LU.LevelInfo:    "mlog-info",
+	LU.LevelOkay:    "mlog-okay",
+	LU.LevelWarning: "mlog-warning",
+	LU.LevelError:   "mlog-error",
+	LU.LevelPanic:   "mlog-panic",
+}
+
+// HtmlStyle is a style sheet for the classes in HtmlLevelClasses,
+// with the same colors as the console. HtmlTarget does not write
+// it; it is for the page that contains the log.
+const HtmlStyle = `<style>
+.mlog-debug   { color: grey; }
+.mlog-info    { color: darkcyan; }
+.mlog-okay    { color: green; }
+.mlog-warning { color: red; }
+.mlog-error   { color: red; font-weight: bold; }
+.mlog-panic   { color: magenta; font-weight: bold; }
+.mlog-quote pre { margin: 0 0 0 2em; }
+.mlog-details > :not(summary) { margin-left: 2em; }
+</style>
+`
+
+// HtmlFormatter formats a log message as a line of HTML: the message
+// as formatted by the Logger (or by DefaultFormatter, if it has not
+// been formatted yet) is HTML-escaped, put in a <span> that has the
+// CSS class of its level, and ended with <br/> (not with a newline).
+// It is for targets that write HTML but not with an HtmlTarget, such
+// as MailTarget (see MailTarget.HTML); an HtmlTarget does the same by
+// itself, and would escape the markup of HtmlFormatter again.
+func HtmlFormatter(l *Logger, e *Entry) string {
+	msg := e.FormattedMessage
+	if msg == "" {
+		msg = DefaultFormatter(l, e)
+	}
+	return htmlSpan(msg, e.Level) + "<br/>"
+}
+
+// htmlSpan escapes the text, turns its newlines into <br/>'s,
+// and wraps it in a <span> with the CSS class of the level.
+func htmlSpan(text string, lvl LU.Level) string {
+	text = S.ReplaceAll(html.EscapeString(text), "\n", "<br/>\n")
+	cls, ok := HtmlLevelClasses[lvl]
+	if !ok {
+		return "<span>" + text + "</span>"
+	}
+	return `<span class="` + cls + `">` + text + "</span>"
+}
+
+// HtmlTarget writes filtered log messages as HTML, to be put in the
+// HTML element that has ID FieldID. Every log message ends with <br/>
+// rather than a newline, and details blocks and text quotes are
+// collapsible <details> elements.
 type HtmlTarget struct {
 	*Filter
 	// the target HTML element's ID attribute.
-	FieldID   string
-	Writer    io.Writer // the writer to write log messages
+	FieldID string
+	Writer  io.Writer // the writer to write log messages
+	// the formatter to use instead of the Logger's. What it returns is
+	// HTML-escaped, so it should be text, not e.g. HtmlFormatter.
+	Formatter Formatter
 	errWriter io.Writer
 	close     chan bool
 	DetailsInfo
 }
+
+// NewHtmlTarget creates an HtmlTarget.
+// The new HtmlTarget takes these default options:
+// MaxLevel: LU.LevelDebug. You must specify the Writer field.
+// If FieldID is set, the log is written in a <div> with that ID.
+func NewHtmlTarget() *HtmlTarget {
+	return &HtmlTarget{
+		Filter: &Filter{MaxLevel: LU.LevelDebug},
+		close:  make(chan bool, 0),
+		DetailsInfo: DetailsInfo{
+			DetailsFormatter: DefaultDetailsFormatter,
+		},
+	}
+}
+
+// Open prepares HtmlTarget for processing log messages.
+func (t *HtmlTarget) Open(errWriter io.Writer) error {
+	t.Filter.Init()
+	if t.Writer == nil {
+		return errors.New("HtmlTarget.Writer cannot be nil")
+	}
+	t.errWriter = errWriter
+	t.DoingDetails = false
+	if t.FieldID != "" {
+		t.write(`<div id="` + html.EscapeString(t.FieldID) + `" class="mlog">` + "\n")
+	}
+	return nil
+}
+
+// Process writes a log message as a line of HTML.
+func (t *HtmlTarget) Process(e *Entry) {
+	if e == nil {
+		if t.DoingDetails {
+			t.CloseLogDetailsBlock("")
+		}
+		if t.FieldID != "" {
+			t.write("</div>\n")
+		}
+		t.close <- true
+		return
+	}
+	if !t.Allow(e) {
+		return
+	}
+	t.noteLevel(e.Level)
+	t.write(htmlSpan(e.Format(t.Formatter), e.Level) + "<br/>\n")
+}
+
+// Close closes the HTML target.
+func (t *HtmlTarget) Close() {
+	<-t.close
+}
+
+// Flush flushes the Writer, if it can be flushed (e.g. a bufio.Writer).
+func (t *HtmlTarget) Flush() {
+	if f, ok := t.Writer.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			fmt.Fprintf(t.errWriter, "HtmlTarget flush error: %v\n", err)
+		}
+	}
+}
+
+func (t *HtmlTarget) DoesDetails() bool {
+	return true
+}
+
+func (t *HtmlTarget) SetCategory(s string) {
+	t.Category = s
+}
+
+func (t *HtmlTarget) SetSubcategory(s string) {
+	t.Subcategory = s
+}
+
+// StartLogDetailsBlock opens a <details> element, with
+// the entry as its <summary>. An open block is closed first.
+// If the Filter does not allow the entry, no block is opened,
+// and the messages of the set are written as plain lines.
+func (t *HtmlTarget) StartLogDetailsBlock(sCatg string, e *Entry) {
+	if t.DoingDetails {
+		t.CloseLogDetailsBlock("")
+	}
+	if !t.Allow(e) {
+		return
+	}
+	t.write(`<details class="mlog-details"><summary>` +
+		htmlSpan(e.Format(t.Formatter), e.Level) + "</summary>\n")
+	t.startDetails(sCatg)
+}
+
+// CloseLogDetailsBlock closes the <details> element, and follows
+// it (so that it is visible when the block is collapsed) with a
+// summary line in the style of the block's most severe level.
+func (t *HtmlTarget) CloseLogDetailsBlock(s string) {
+	if !t.DoingDetails {
+		return
+	}
+	t.DoingDetails = false
+	t.write("</details>\n")
+	if s != "" {
+		t.write(htmlSpan(LU.EmojiOfLevel(t.MinLogLevel)+" "+s,
+			t.MinLogLevel) + "<br/>\n")
+	}
+}
+
+// LogTextQuote writes a collapsible block of text, as a <pre>
+// in a <details> element whose <summary> is the entry.
+func (t *HtmlTarget) LogTextQuote(e *Entry, s string) {
+	if !t.Allow(e) {
+		return
+	}
+	t.noteLevel(e.Level)
+	t.write(`<details class="mlog-quote"><summary>` +
+		htmlSpan(e.Format(t.Formatter), e.Level) + "</summary><pre>" +
+		html.EscapeString(s) + "</pre></details>\n")
+}
+
+func (t *HtmlTarget) write(s string) {
+	if _, err := io.WriteString(t.Writer, s); err != nil {
+		fmt.Fprintf(t.errWriter, "HtmlTarget write error: %v\n", err)
+	}
+}
@@ -0,0 +1,75 @@
+package log_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestHtmlTarget(t *testing.T) {
+	var target log.DetailsTarget = log.NewHtmlTarget()
+	ht := target.(*log.HtmlTarget)
+	writer := &MemoryWriter{}
+	ht.Writer = writer
+	ht.FieldID = "log"
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("HtmlTarget.Open(): %v", err)
+	}
+	entry := func(lvl LU.Level, msg string) *log.Entry {
+		return &log.Entry{Level: lvl, Message: msg, FormattedMessage: msg}
+	}
+	target.Process(entry(LU.LevelInfo, "a <b> & c"))
+	target.StartLogDetailsBlock("[01]", entry(LU.LevelInfo, "details"))
+	target.Process(entry(LU.LevelWarning, "d1"))
+	target.Process(entry(LU.LevelInfo, "d2"))
+	target.CloseLogDetailsBlock("done")
+	target.LogTextQuote(entry(LU.LevelInfo, "quote"), "x < y\nz")
+	go target.Process(nil)
+	target.Close()
+
+	result := string(writer.bytes)
+	expected := []string{
+		`<div id="log" class="mlog">`,
+		`<span class="mlog-info">a &lt;b&gt; &amp; c</span><br/>`,
+		`<details class="mlog-details"><summary><span class="mlog-info">details</span></summary>`,
+		`<span class="mlog-warning">d1</span><br/>`,
+		"</details>\n<span class=\"mlog-warning\">",
+		"<pre>x &lt; y\nz</pre></details>",
+		"</div>",
+	}
+	for _, s := range expected {
+		if !strings.Contains(result, s) {
+			t.Errorf("Expected %q not found in %q", s, result)
+		}
+	}
+	if ht.MinLogLevel != LU.LevelWarning {
+		t.Errorf("MinLogLevel = %v, expected %v", ht.MinLogLevel, LU.LevelWarning)
+	}
+}
+
+func TestHtmlTargetFilter(t *testing.T) {
+	target := log.NewHtmlTarget()
+	writer := &MemoryWriter{}
+	target.Writer = writer
+	target.MaxLevel = LU.LevelWarning
+	if err := target.Open(os.Stderr); err != nil {
+		t.Fatalf("HtmlTarget.Open(): %v", err)
+	}
+	entry := func(lvl LU.Level, msg string) *log.Entry {
+		return &log.Entry{Level: lvl, Message: msg, FormattedMessage: msg}
+	}
+	target.StartLogDetailsBlock("[01]", entry(LU.LevelInfo, "details"))
+	target.Process(entry(LU.LevelWarning, "d1"))
+	target.CloseLogDetailsBlock("done")
+	target.LogTextQuote(entry(LU.LevelInfo, "quote"), "q1")
+	go target.Process(nil)
+	target.Close()
+
+	expected := `<span class="mlog-warning">d1</span><br/>` + "\n"
+	if result := string(writer.bytes); result != expected {
+		t.Errorf("HTML = %q, expected %q", result, expected)
+	}
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	S "strings"
+	"time"
+)
+
+// jsonEntry is the JSON Lines representation of an Entry.
+type jsonEntry struct {
+	Time        string                     `json:"time"`
+	Level       string                     `json:"level"`
+	LevelNum    int                        `json:"levelNum"`
+	Category    string                     `json:"category,omitempty"`
+	Subcategory string                     `json:"subcategory,omitempty"`
+	Message     string                     `json:"message"`
+	CallStack   []string                   `json:"callStack,omitempty"`
+	Special     []string                   `json:"special,omitempty"`
+	Fields      map[string]json.RawMessage `json:"fields,omitempty"`
+}
+
+// JSONFormatter formats a log message as a single line of JSON (i.e.
+// JSON Lines), for log shippers to ingest without any regex parsing.
+// For example:
+//
+//	{"time":"2026-10-16T15:04:05.123+03:00","level":"Info","levelNum":6,
+//	"category":"app","message":"parsed OK","fields":{"reqID":42}}
+//
+// The call stack frames (if any) are an array of "file:line" strings.
+// A field value that cannot be marshalled is written as its %v string.
+// It is usually set as the Formatter of a FileTarget or NetworkTarget,
+// rather than of a Logger, so that other Targets keep their emoji.
+func JSONFormatter(l *Logger, e *Entry) string {
+	return formatJSON(e, nil)
+}
+
+// JSONDetailsFormatter is the DetailsFormatter counterpart of
+// JSONFormatter. The per-message strings go into "special".
+func JSONDetailsFormatter(l *Logger, e *Entry, spcl []string) string {
+	return formatJSON(e, spcl)
+}
+
+func formatJSON(e *Entry, spcl []string) string {
+	je := jsonEntry{
+		Time:        e.Time.Format(time.RFC3339Nano),
+		Level:       e.Level.String(),
+		LevelNum:    int(e.Level),
+		Category:    e.Category,
+		Subcategory: e.Subcategory,
+		Message:     e.Message,
+		Special:     spcl,
+	}
+	if e.CallStack != "" {
+		je.CallStack = S.Split(S.TrimPrefix(e.CallStack, "\n"), "\n")
+	}
+	if len(e.Fields) > 0 {
+		je.Fields = make(map[string]json.RawMessage, len(e.Fields))
+		for _, f := range e.Fields {
+			je.Fields[f.Key] = jsonValue(f.Value)
+		}
+	}
+	b, err := json.Marshal(je)
+	if err != nil {
+		// Cannot happen, since every field is already valid JSON.
+		return fmt.Sprintf(`{"message":%q,"error":%q}`, e.Message, err.Error())
+	}
+	return string(b)
+}
+
+// jsonValue marshals a field value, falling back to its %v string.
+func jsonValue(v interface{}) json.RawMessage {
+	if err, ok := v.(error); ok {
+		v = err.Error()
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		b, _ = json.Marshal(fmt.Sprint(v))
+	}
+	return b
+}
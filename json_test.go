@@ -0,0 +1,79 @@
+package log_test
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestJSONFormatter(t *testing.T) {
+	e := &log.Entry{
+		Level:       LU.LevelWarning,
+		Category:    "app",
+		Subcategory: "st1b",
+		Message:     "line1\nline2",
+		Fields:      []log.Field{{"n", 42}, {"err", errors.New("boom")}, {"ch", make(chan int)}},
+		Time:        time.Date(2026, 10, 16, 15, 4, 5, 0, time.UTC),
+		CallStack:   "\na.go:1\nb.go:2",
+	}
+	s := log.JSONFormatter(nil, e)
+	if strings.Contains(s, "\n") {
+		t.Errorf("JSONFormatter() output is not a single line: %q", s)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal([]byte(s), &m); err != nil {
+		t.Fatalf("json.Unmarshal(): %v", err)
+	}
+	expected := map[string]interface{}{
+		"time":        "2026-10-16T15:04:05Z",
+		"level":       LU.LevelWarning.String(),
+		"levelNum":    float64(LU.LevelWarning),
+		"category":    "app",
+		"subcategory": "st1b",
+		"message":     "line1\nline2",
+	}
+	for k, v := range expected {
+		if m[k] != v {
+			t.Errorf("%s = %v, expected %v", k, m[k], v)
+		}
+	}
+	if cs, _ := m["callStack"].([]interface{}); len(cs) != 2 || cs[1] != "b.go:2" {
+		t.Errorf("callStack = %v, expected [a.go:1 b.go:2]", m["callStack"])
+	}
+	fields, _ := m["fields"].(map[string]interface{})
+	if fields["n"] != float64(42) || fields["err"] != "boom" || fields["ch"] == nil {
+		t.Errorf("fields = %v", fields)
+	}
+}
+
+func TestFileTargetJSON(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.log")
+
+	logger := log.NewLogger()
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	target.Formatter = log.JSONFormatter
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.With("reqID", 7).Info("t1")
+	logger.Close()
+
+	bytes, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(bytes, &m); err != nil {
+		t.Fatalf("json.Unmarshal(%q): %v", bytes, err)
+	}
+	if m["message"] != "t1" {
+		t.Errorf("message = %v, expected %v", m["message"], "t1")
+	}
+}
@@ -0,0 +1,163 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	"net/http"
+	S "strings"
+)
+
+// LevelHandler is an http.Handler that shows the levels of a logger
+// and its targets (on GET), and changes the levels (on PUT), so that
+// the verbosity of a running service can be raised without a restart.
+// The body of a GET response (and of a PUT request) is JSON, e.g.
+//
+//	{"maxLevel":"Info","categoryLevels":{"db.*":"Progress"},
+//	"targets":[{"type":"*log.ConsoleTarget","maxLevel":"Okay"}]}
+//
+// A level is its name (as in Level.String) or its number, from
+// LevelPanic to LevelDebug. In a PUT, maxLevel and categoryLevels
+// can each be left out; categoryLevels replaces all of the category
+// levels. The targets, i.e. those that the logger opened, are shown
+// with their Filter (if they embed one), and are ignored in a PUT.
+// The handler does no authorization, so it should be served only
+// where it is safe to.
+type LevelHandler struct {
+	logger *coreLogger
+}
+
+// NewLevelHandler creates a LevelHandler of the Logger's coreLogger.
+func NewLevelHandler(l *Logger) *LevelHandler {
+	return &LevelHandler{logger: l.coreLogger}
+}
+
+// jsonLevel is a level as LevelHandler shows it: its name if it
+// has one, or else its number. Either is accepted in a PUT.
+type jsonLevel LU.Level
+
+func (lvl jsonLevel) MarshalJSON() ([]byte, error) {
+	if _, ok := levelOfName(LU.Level(lvl).String()); ok {
+		return json.Marshal(LU.Level(lvl).String())
+	}
+	return json.Marshal(int(lvl))
+}
+
+func (lvl *jsonLevel) UnmarshalJSON(b []byte) error {
+	var n int
+	if err := json.Unmarshal(b, &n); err == nil {
+		if n < int(LU.LevelPanic) || n > int(LU.LevelDebug) {
+			return fmt.Errorf("level %d is not in %d..%d", n, LU.LevelPanic, LU.LevelDebug)
+		}
+		*lvl = jsonLevel(n)
+		return nil
+	}
+	var name string
+	if err := json.Unmarshal(b, &name); err != nil {
+		return fmt.Errorf("a level must be a name or a number, not %s", b)
+	}
+	l, ok := levelOfName(name)
+	if !ok {
+		return fmt.Errorf("unknown level %q", name)
+	}
+	*lvl = jsonLevel(l)
+	return nil
+}
+
+// levelOfName returns the level whose String() is the name,
+// regardless of case.
+func levelOfName(name string) (LU.Level, bool) {
+	for lvl := LU.LevelPanic; lvl <= LU.LevelDebug; lvl++ {
+		if S.EqualFold(lvl.String(), name) {
+			return lvl, true
+		}
+	}
+	return 0, false
+}
+
+type jsonLevels struct {
+	MaxLevel       *jsonLevel           `json:"maxLevel,omitempty"`
+	CategoryLevels map[string]jsonLevel `json:"categoryLevels"`
+	Targets        []jsonTarget         `json:"targets"`
+}
+
+type jsonTarget struct {
+	Type       string     `json:"type"`
+	MaxLevel   *jsonLevel `json:"maxLevel,omitempty"`
+	Categories []string   `json:"categories,omitempty"`
+}
+
+// ServeHTTP shows the levels on GET, and changes them on PUT.
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead:
+	case http.MethodPut:
+		var req jsonLevels
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&req); err != nil {
+			http.Error(w, "Invalid levels: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		h.setLevels(&req)
+	default:
+		w.Header().Set("Allow", "GET, HEAD, PUT")
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	b, err := json.Marshal(h.levels())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(append(b, '\n'))
+}
+
+// setLevels changes the levels of a PUT, both at once.
+func (h *LevelHandler) setLevels(req *jsonLevels) {
+	l := h.logger
+	l.levelLock.Lock()
+	defer l.levelLock.Unlock()
+	if req.MaxLevel != nil {
+		l.MaxLevel = LU.Level(*req.MaxLevel)
+	}
+	if req.CategoryLevels != nil {
+		levels := make(map[string]LU.Level, len(req.CategoryLevels))
+		for ctg, lvl := range req.CategoryLevels {
+			levels[ctg] = LU.Level(lvl)
+		}
+		l.CategoryLevels = levels
+	}
+	l.updateLevels()
+}
+
+// levels returns the levels and the targets, as shown on GET.
+func (h *LevelHandler) levels() *jsonLevels {
+	l := h.logger
+	maxLevel, ctgLevels := l.getLevels()
+	resp := &jsonLevels{
+		MaxLevel:       (*jsonLevel)(&maxLevel),
+		CategoryLevels: make(map[string]jsonLevel, len(ctgLevels)),
+		Targets:        []jsonTarget{},
+	}
+	for ctg, lvl := range ctgLevels {
+		resp.CategoryLevels[ctg] = jsonLevel(lvl)
+	}
+	// not queueLock, which waits for a stuck target
+	l.targetLock.Lock()
+	targets := l.targets
+	l.targetLock.Unlock()
+	for _, target := range targets {
+		jt := jsonTarget{Type: fmt.Sprintf("%T", target)}
+		if ft, ok := target.(interface{ filter() *Filter }); ok {
+			if f := ft.filter(); f != nil {
+				lvl := jsonLevel(f.MaxLevel)
+				jt.MaxLevel = &lvl
+				jt.Categories = f.Categories
+			}
+		}
+		resp.Targets = append(resp.Targets, jt)
+	}
+	return resp
+}
@@ -0,0 +1,138 @@
+package log_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestLevelHandler(t *testing.T) {
+	logger := log.NewLogger()
+	logger.MaxLevel = LU.LevelInfo
+	logger.CategoryLevels = map[string]LU.Level{"db.*": LU.LevelWarning}
+	console := log.NewConsoleTarget()
+	console.Writer = &MemoryWriter{}
+	console.MaxLevel = LU.LevelOkay
+	console.Categories = []string{"app", "db.*"}
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, console, target)
+	logger.Open()
+	defer logger.Close()
+	handler := log.NewLevelHandler(logger)
+
+	serve := func(method, body string) (int, map[string]interface{}) {
+		req := httptest.NewRequest(method, "/log/levels", strings.NewReader(body))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		var resp map[string]interface{}
+		if rec.Code == http.StatusOK {
+			if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+				t.Errorf("%s: invalid JSON %q: %v", method, rec.Body.String(), err)
+			}
+		}
+		return rec.Code, resp
+	}
+	asJSON := func(v interface{}) string {
+		b, _ := json.Marshal(v)
+		return string(b)
+	}
+
+	code, resp := serve("GET", "")
+	if code != http.StatusOK {
+		t.Fatalf("GET: status %v", code)
+	}
+	info, okay, warning := LU.LevelInfo.String(), LU.LevelOkay.String(), LU.LevelWarning.String()
+	if s := asJSON(resp["maxLevel"]); s != `"`+info+`"` {
+		t.Errorf("GET: maxLevel = %s, expected %q", s, info)
+	}
+	if s := asJSON(resp["categoryLevels"]); s != `{"db.*":"`+warning+`"}` {
+		t.Errorf("GET: categoryLevels = %s", s)
+	}
+	expected := `[{"categories":["app","db.*"],"maxLevel":"` + okay +
+		`","type":"*log.ConsoleTarget"},{"type":"*log_test.SlowTarget"}]`
+	if s := asJSON(resp["targets"]); s != expected {
+		t.Errorf("GET: targets = %s, expected %s", s, expected)
+	}
+
+	db := logger.GetLogger("db.query")
+	db.Info("t1")
+	code, resp = serve("PUT", `{"maxLevel":"warning","categoryLevels":{"db.*":`+
+		asJSON(int(LU.LevelInfo))+`}}`)
+	if code != http.StatusOK {
+		t.Fatalf("PUT: status %v", code)
+	}
+	if s := asJSON(resp["maxLevel"]); s != `"`+warning+`"` {
+		t.Errorf("PUT: maxLevel = %s, expected %q", s, warning)
+	}
+	db.Info("t2")
+	logger.Info("t3")
+	logger.Warning("t4")
+	logger.Flush()
+	if result := target.Messages(); result != "t2,t4,flush" {
+		t.Errorf("target got %q, expected %q", result, "t2,t4,flush")
+	}
+
+	// categoryLevels is left as it is if it is left out.
+	serve("PUT", `{"maxLevel":"info"}`)
+	if _, resp = serve("GET", ""); asJSON(resp["categoryLevels"]) != `{"db.*":"`+info+`"}` {
+		t.Errorf("GET: categoryLevels = %s", asJSON(resp["categoryLevels"]))
+	}
+
+	tests := []struct {
+		method, body string
+		code         int
+	}{
+		{"PUT", `{"maxLevel":"loud"}`, http.StatusBadRequest},
+		{"PUT", `{"maxLevel":true}`, http.StatusBadRequest},
+		{"PUT", `{"maxLevel":99}`, http.StatusBadRequest},
+		{"PUT", `{"categoryLevels":{"db.*":-1}}`, http.StatusBadRequest},
+		{"PUT", `{"level":"info"}`, http.StatusBadRequest},
+		{"PUT", `not json`, http.StatusBadRequest},
+		{"POST", `{}`, http.StatusMethodNotAllowed},
+		{"DELETE", ``, http.StatusMethodNotAllowed},
+	}
+	for _, test := range tests {
+		if code, _ := serve(test.method, test.body); code != test.code {
+			t.Errorf("%s %s: status %v, expected %v", test.method, test.body, code, test.code)
+		}
+	}
+	if _, resp = serve("GET", ""); asJSON(resp["maxLevel"]) != `"`+info+`"` {
+		t.Errorf("maxLevel = %s after bad requests, expected %q", asJSON(resp["maxLevel"]), info)
+	}
+}
+
+func TestLevelHandlerWithStuckTarget(t *testing.T) {
+	logger := log.NewLogger()
+	logger.BufferSize = 1
+	slow := NewSlowTarget(true)
+	logger.Targets = append(logger.Targets, slow)
+	logger.Open()
+	logger.Info("t1")
+	<-slow.entered // t1 is being processed
+	logger.Info("t2")
+	go logger.Info("t3") // waits for room in the full queue
+	time.Sleep(10 * time.Millisecond)
+
+	done := make(chan int)
+	go func() {
+		rec := httptest.NewRecorder()
+		log.NewLevelHandler(logger).ServeHTTP(rec, httptest.NewRequest("GET", "/", nil))
+		done <- rec.Code
+	}()
+	select {
+	case code := <-done:
+		if code != http.StatusOK {
+			t.Errorf("GET: status %v", code)
+		}
+	case <-time.After(time.Second):
+		t.Errorf("GET waited for the stuck target")
+	}
+	close(slow.release)
+	logger.Close()
+}
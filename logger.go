@@ -10,14 +10,17 @@ package log
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	LU "github.com/fbaube/logutils"
 	"io"
 	"os"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
@@ -40,25 +43,54 @@ func init() {
 type Entry struct {
 	Level            LU.Level
 	Category         string
+	Subcategory      string // as last set by coreLogger.SetSubcategory
 	Message          string
+	Fields           []Field // key/value attributes, see Logger.With
 	Time             time.Time
 	CallStack        string
 	FormattedMessage string
+
+	logger  *Logger         // the Logger that created the entry
+	op      entryOp         // what process() does with the entry
+	arg     string          // the operand of op, e.g. the text of a quote
+	flushed *sync.WaitGroup // for opFlush, done by each target
+}
+
+// Field is a key/value attribute carried by an Entry, so that
+// things like a request ID or an input file path need not be
+// baked into the message text.
+type Field struct {
+	Key   string
+	Value interface{}
 }
 
+// badKey is used for a With argument that is not a string key.
+const badKey = "!BADKEY"
+
 // String returns the string representation of the log entry
 func (e *Entry) String() string {
 	return e.FormattedMessage
 }
 
+// Format returns the entry as formatted by f, or as already
+// formatted by its Logger (i.e. e.String()) if f is nil. It
+// lets a Target use its own Formatter, such as JSONFormatter.
+func (e *Entry) Format(f Formatter) string {
+	if f == nil {
+		return e.String()
+	}
+	return f(e.logger, e)
+}
+
 // Target represents a target where the logger can
 // send log messages to for further processing.
 type Target interface {
 	// Open prepares the target for processing log messages.
-	// Called when Logger.Open() is called.
-	// If an error is returned, the target will be removed from the
-	// logger. errWriter should be used to write errors found while
-	// processing log messages, and should probably default to Stderr.
+	// Called when Logger.Open() is called, again if the logger is
+	// reopened after Logger.Close(). If an error is returned, the
+	// target is left out until the logger is opened again. errWriter
+	// should be used to write errors found while processing log
+	// messages, and should probably default to Stderr.
 	Open(errWriter io.Writer) error
 	// Process processes an incoming log message.
 	Process(*Entry)
@@ -75,18 +107,52 @@ type Target interface {
 
 // coreLogger maintains the log messages in a channel and sends them to various targets.
 type coreLogger struct {
-	lock        sync.Mutex
-	open        bool        // whether the logger is open
-	entries     chan *Entry // log entries
-	ErrorWriter io.Writer   // the writer to record errors caused by log targets
+	lock        sync.Mutex    // serializes Open and Close
+	open        atomic.Bool   // whether the logger is open; see enqueue
+	closed      chan struct{} // closed when the targets of the last Close are closed
+	ErrorWriter io.Writer     // the writer to record errors caused by log targets
 
-	BufferSize     int // the size of the channel storing log entries
+	BufferSize     int // the size of the queue of log entries of each target
 	CallStackDepth int // the number of call stack frames to log for each
 	//                 // message. 0 means do not log any call stack frame.
 	CallStackFilter string // a substring that a call stack frame filepath
 	//                     // should contain in order for the frame to be counted
 	MaxLevel LU.Level // the maximum level of messages to be logged
-	Targets  []Target // targets for sending log messages to
+	// the maximum levels of some categories, in place of MaxLevel, e.g.
+	// "db.*": LevelDebug. As in Filter.Categories, a category can use "*"
+	// as a suffix for wildcard matching. They and MaxLevel are read by
+	// Open; to change them later, call SetMaxLevel and SetCategoryLevel.
+	CategoryLevels map[string]LU.Level
+	Targets        []Target // targets for sending log messages to
+	// what to do with a message when the queue of a target is full
+	Overflow OverflowPolicy
+	// how long to wait for room in a queue, for OverflowBlockTimeout
+	OverflowTimeout time.Duration
+	// whether Log hands messages to the targets itself (one at a time),
+	// rather than queueing them for the targets' goroutines. Messages
+	// then come out in order with other output, e.g. of fmt.Println,
+	// but Log waits for the slowest target. It is read by Open.
+	Synchronous bool
+
+	synchronous bool          // Synchronous, as of Open
+	queueLock   sync.Mutex    // keeps the entries in the same order in every queue
+	tickets     uint64        // the ticket of the next entry, see entryQueue
+	targetLock  sync.Mutex    // for reading targets without waiting for queueLock
+	targets     []Target      // the Targets that Open opened
+	queues      []*entryQueue // of the targets, unless synchronous
+
+	levelLock sync.Mutex                 // for changes of the levels
+	levels    atomic.Pointer[levelTable] // of MaxLevel and CategoryLevels
+
+	ctgLock     sync.Mutex
+	category    string // as set by SetCategory, for new details blocks
+	subcategory string // as set by SetSubcategory, for new entries
+
+	detailsSummary string // of the open details block, used by enqueue
+
+	sigLock sync.Mutex
+	sigChan chan os.Signal // see ReopenOnSignal
+	sigStop chan bool
 }
 
 // Formatter formats a log message into an appropriate string.
@@ -97,20 +163,23 @@ type Logger struct {
 	*coreLogger
 	Category  string    // the category associated with this logger
 	Formatter Formatter // message formatter
+	Fields    []Field   // fields attached to every message of this logger
 }
 
 // NewLogger creates a root logger.
 // The new logger takes these default options:
 // ErrorWriter: os.Stderr, BufferSize: 1024, MaxLevel: LU.LevelDebug,
-// Category: app, Formatter: DefaultFormatter
+// Category: app, Formatter: DefaultFormatter, Overflow: OverflowBlock,
+// OverflowTimeout: 100ms
 func NewLogger() *Logger {
 	logger := &coreLogger{
-		ErrorWriter: os.Stderr,
-		BufferSize:  1024,
-		MaxLevel:    LU.LevelDebug,
-		Targets:     make([]Target, 0),
+		ErrorWriter:     os.Stderr,
+		BufferSize:      1024,
+		MaxLevel:        LU.LevelDebug,
+		Targets:         make([]Target, 0),
+		OverflowTimeout: 100 * time.Millisecond,
 	}
-	pCoreLogger = &Logger{logger, "", DefaultFormatter}
+	pCoreLogger = &Logger{coreLogger: logger, Formatter: DefaultFormatter}
 	return pCoreLogger // &Logger{logger, "", DefaultFormatter}
 }
 
@@ -118,12 +187,13 @@ func NewLogger() *Logger {
 // .
 func NewNullLogger() *Logger {
 	logger := &coreLogger{
-		ErrorWriter: io.Discard,
-		BufferSize:  1024,
-		MaxLevel:    LU.LevelError,
-		Targets:     make([]Target, 0),
+		ErrorWriter:     io.Discard,
+		BufferSize:      1024,
+		MaxLevel:        LU.LevelError,
+		Targets:         make([]Target, 0),
+		OverflowTimeout: 100 * time.Millisecond,
 	}
-	pCoreLogger = &Logger{logger, "", DefaultFormatter}
+	pCoreLogger = &Logger{coreLogger: logger, Formatter: DefaultFormatter}
 	return pCoreLogger // &Logger{logger, "", DefaultFormatter}
 }
 
@@ -131,19 +201,72 @@ func NewNullLogger() *Logger {
 // Messages logged thru this logger will carry the same category name.
 // The formatter, if not specified, will inherit from the calling logger.
 // It will be used to format all messages logged thru this logger.
+// The fields of the calling logger are inherited too.
 func (l *Logger) GetLogger(category string, formatter ...Formatter) *Logger {
 	if len(formatter) > 0 {
-		return &Logger{l.coreLogger, category, formatter[0]}
+		return &Logger{l.coreLogger, category, formatter[0], l.Fields}
 	}
-	return &Logger{l.coreLogger, category, l.Formatter}
+	return &Logger{l.coreLogger, category, l.Formatter, l.Fields}
+}
+
+// With creates a logger that shares the same coreLogger, category and
+// formatter, and that attaches the given key/value pairs (in addition
+// to the fields of the calling logger) to every message it logs.
+// Arguments alternate between a string key and its value, e.g.
+// L.With("reqID", id, "file", path). A key that is not a string,
+// or a final key with no value, is recorded under key "!BADKEY".
+func (l *Logger) With(kvs ...interface{}) *Logger {
+	fields := make([]Field, len(l.Fields), len(l.Fields)+(len(kvs)+1)/2)
+	copy(fields, l.Fields)
+	for len(kvs) > 0 {
+		key, ok := kvs[0].(string)
+		if !ok || len(kvs) == 1 {
+			fields = append(fields, Field{badKey, kvs[0]})
+			kvs = kvs[1:]
+			continue
+		}
+		fields = append(fields, Field{key, kvs[1]})
+		kvs = kvs[2:]
+	}
+	return &Logger{l.coreLogger, l.Category, l.Formatter, fields}
 }
 
 // Panic logs a message indicating the system is dying,
-// but does NOT actually execute a call to panic(..)
+// but does NOT actually execute a call to panic(..);
+// for that, see Panicf and Fatal.
 func (l *Logger) Panic(format string, a ...interface{}) {
 	l.Log(LU.LevelPanic, format, a...)
 }
 
+// ExitFunc is called by Fatal to exit the program.
+// Tests can replace it to intercept the exit.
+var ExitFunc = os.Exit
+
+// Panicf logs a message at LevelPanic, flushes the
+// targets, and then panics with the message.
+func (l *Logger) Panicf(format string, a ...interface{}) {
+	message := format
+	if len(a) > 0 {
+		message = fmt.Sprintf(format, a...)
+	}
+	l.Log(LU.LevelPanic, message)
+	l.Flush()
+	panic(message)
+}
+
+// Fatal logs a message at LevelPanic, flushes and closes
+// the targets, and then calls ExitFunc(1).
+func (l *Logger) Fatal(format string, a ...interface{}) {
+	message := format
+	if len(a) > 0 {
+		message = fmt.Sprintf(format, a...)
+	}
+	l.Log(LU.LevelPanic, message)
+	l.Flush()
+	l.Close()
+	ExitFunc(1)
+}
+
 // Error logs a message indicating an error condition.
 // This method takes one or multiple parameters. If a
 // single parameter is provided, it IS the log message.
@@ -183,7 +306,7 @@ func (l *Logger) Debug(format string, a ...interface{}) {
 
 // Log logs a message of a specified severity level.
 func (l *Logger) Log(level LU.Level, format string, a ...interface{}) {
-	if level > l.MaxLevel || !l.open {
+	if !l.enabled(level) {
 		return
 	}
 	message := format
@@ -194,18 +317,18 @@ func (l *Logger) Log(level LU.Level, format string, a ...interface{}) {
 		Category: l.Category,
 		Level:    level,
 		Message:  message,
+		Fields:   l.Fields,
 		Time:     time.Now(),
 	}
 	if l.CallStackDepth > 0 {
 		entry.CallStack = GetCallStack(3, l.CallStackDepth, l.CallStackFilter)
 	}
-	entry.FormattedMessage = l.Formatter(l, entry)
-	l.entries <- entry
+	l.dispatch(entry)
 }
 
 func (l *Logger) LogWithString(level LU.Level, format string, special string, a ...interface{}) {
 	// func (l *Logger) Log(level LU.Level, format string, a ...interface{}) {
-	if level > l.MaxLevel || !l.open {
+	if !l.enabled(level) {
 		return
 	}
 	message := format
@@ -216,26 +339,77 @@ func (l *Logger) LogWithString(level LU.Level, format string, special string, a
 		Category: l.Category,
 		Level:    level,
 		Message:  "(" + special + ") " + message,
+		Fields:   l.Fields,
 		Time:     time.Now(),
 	}
 	if l.CallStackDepth > 0 {
 		entry.CallStack = GetCallStack(3, l.CallStackDepth, l.CallStackFilter)
 	}
+	l.dispatch(entry)
+}
+
+// dispatch formats an entry and queues it for the targets.
+func (l *Logger) dispatch(entry *Entry) {
+	entry.logger = l
+	l.ctgLock.Lock()
+	entry.Subcategory = l.subcategory
+	l.ctgLock.Unlock()
 	entry.FormattedMessage = l.Formatter(l, entry)
-	l.entries <- entry
+	l.enqueue(entry)
+}
+
+// enqueue puts an entry in the queue of every target, in the same
+// order, as the Overflow policy allows. If synchronous, it hands
+// the entry to every target instead. It returns false if the logger
+// is not open. The entry gets its ticket under queueLock, and so does
+// the nil that Close queues, once the logger is marked closed, so that
+// nothing is queued after it. queueLock is not held while a push waits.
+func (l *coreLogger) enqueue(entry *Entry) bool {
+	l.queueLock.Lock()
+	if !l.open.Load() {
+		l.queueLock.Unlock()
+		return false
+	}
+	switch entry.op {
+	case opStartDetails:
+		l.detailsSummary = entry.Message
+	case opEndDetails:
+		entry.arg = l.detailsSummary
+	case opFlush:
+		entry.flushed.Add(len(l.targets))
+	}
+	if l.synchronous {
+		defer l.queueLock.Unlock()
+		for _, target := range l.targets {
+			l.deliver(target, entry)
+		}
+		return true
+	}
+	ticket := l.tickets
+	l.tickets++
+	queues := l.queues
+	l.queueLock.Unlock()
+	for _, q := range queues {
+		q.push(entry, ticket, l.Overflow, l.OverflowTimeout)
+	}
+	return true
 }
 
+// SetMaxLevel sets the MaxLevel of the logger that
+// NewLogger (or NewNullLogger) created last.
 func SetMaxLevel(lvl LU.Level) {
-	pCoreLogger.MaxLevel = lvl
+	pCoreLogger.SetMaxLevel(lvl)
 }
 
 // Open prepares the logger and the targets for logging purpose.
-// Open must be called before any message can be logged.
+// Open must be called before any message can be logged. A logger
+// can be opened again after Close, which reopens all of the Targets
+// (once they have finished closing, if CloseContext gave up on them).
 func (l *coreLogger) Open() error {
 	l.lock.Lock()
 	defer l.lock.Unlock()
 
-	if l.open {
+	if l.open.Load() {
 		return nil
 	}
 	if l.ErrorWriter == nil {
@@ -247,56 +421,141 @@ func (l *coreLogger) Open() error {
 	if l.CallStackDepth < 0 {
 		return errors.New("Logger.CallStackDepth must be no less than 0.")
 	}
-	l.entries = make(chan *Entry, l.BufferSize)
+	if l.Overflow == OverflowBlockTimeout && l.OverflowTimeout <= 0 {
+		return errors.New("Logger.OverflowTimeout must be more than 0.")
+	}
+	if l.closed != nil {
+		<-l.closed
+	}
+	l.levelLock.Lock()
+	l.updateLevels()
+	l.levelLock.Unlock()
+	synchronous := l.Synchronous
 	var targets []Target
+	var queues []*entryQueue
 	for _, target := range l.Targets {
 		if err := target.Open(l.ErrorWriter); err != nil {
 			fmt.Fprintf(l.ErrorWriter, "Failed to open target: %v", err)
 		} else {
 			targets = append(targets, target)
+			if !synchronous {
+				queues = append(queues, newEntryQueue(l.BufferSize))
+			}
 		}
 	}
-	l.Targets = targets
-	go l.process()
-	l.open = true
+	l.queueLock.Lock()
+	defer l.queueLock.Unlock()
+	l.targetLock.Lock()
+	l.synchronous = synchronous
+	l.targets = targets
+	l.queues = queues
+	l.targetLock.Unlock()
+	l.tickets = 0
+	l.detailsSummary = ""
+	for i, q := range queues {
+		go l.process(targets[i], q)
+	}
+	l.open.Store(true)
 	return nil
 }
 
-// process sends the messages to targets for processing.
-func (l *coreLogger) process() {
+// process sends the messages in a target's queue to the target,
+// until the nil that signals the close of the logger.
+func (l *coreLogger) process(target Target, q *entryQueue) {
 	for {
-		entry := <-l.entries
-		for _, target := range l.Targets {
-			target.Process(entry)
-		}
+		entry := q.pop()
+		l.deliver(target, entry)
 		if entry == nil {
-			break
+			return
 		}
 	}
 }
 
+// Dropped returns the number of messages that the Overflow
+// policy has dropped, added up over all of the targets.
+func (l *coreLogger) Dropped() uint64 {
+	l.targetLock.Lock()
+	defer l.targetLock.Unlock()
+	var n uint64
+	for _, q := range l.queues {
+		n += q.droppedCount()
+	}
+	return n
+}
+
+// DroppedFor returns the number of messages that the
+// Overflow policy has dropped for one of the targets.
+func (l *coreLogger) DroppedFor(target Target) uint64 {
+	l.targetLock.Lock()
+	defer l.targetLock.Unlock()
+	for i, t := range l.targets {
+		if t == target && i < len(l.queues) {
+			return l.queues[i].droppedCount()
+		}
+	}
+	return 0
+}
+
 // Close closes the logger and the targets.
 // Existing messages will be processed before the targets are closed.
 // New incoming messages will be discarded after calling this method.
+// Close can be called more than once, also concurrently with logging;
+// every call returns once the targets are closed.
 func (l *coreLogger) Close() {
-	if !l.open {
-		return
+	l.CloseContext(context.Background())
+}
+
+// CloseContext is Close, except that it stops waiting for the targets
+// to close when ctx is done, and then returns ctx.Err(). The targets
+// go on closing in the background, and Open waits for them.
+func (l *coreLogger) CloseContext(ctx context.Context) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.open.Load() {
+		l.open.Store(false)
+		l.closed = make(chan struct{})
+		// It may have to wait for a stuck target, so ctx covers it all.
+		go l.shutdown(l.closed)
 	}
-	l.open = false
-	// use a nil entry to signal the close of logger
-	l.entries <- nil
-	for _, target := range l.Targets {
+	if l.closed == nil {
+		return nil
+	}
+	select {
+	case <-l.closed:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// shutdown queues the nil that signals the close of the logger
+// (after the entries that were queued before the logger was marked
+// closed), closes the targets, and then closes closed.
+func (l *coreLogger) shutdown(closed chan struct{}) {
+	l.queueLock.Lock()
+	ticket := l.tickets
+	l.tickets++
+	targets, queues, synchronous := l.targets, l.queues, l.synchronous
+	l.queueLock.Unlock()
+	for _, q := range queues {
+		q.push(nil, ticket, l.Overflow, l.OverflowTimeout)
+	}
+	for _, target := range targets {
+		if synchronous {
+			// A target's Process(nil) waits for its Close.
+			go target.Process(nil)
+		}
 		target.Close()
 	}
+	close(closed)
 }
 
-// Flush flushes the logger and the targets.
+// Flush flushes the targets, once they have processed the
+// messages that were logged before it, and waits for them.
 func (l *coreLogger) Flush() {
-	if !l.open {
-		return
-	}
-	for _, target := range l.Targets {
-		target.Flush()
+	var flushed sync.WaitGroup
+	if l.enqueue(&Entry{Time: time.Now(), op: opFlush, flushed: &flushed}) {
+		flushed.Wait()
 	}
 }
 
@@ -312,9 +571,28 @@ func DefaultFormatter(l *Logger, e *Entry) string {
 	if e.Category != "" {
 		sCtg = fmt.Sprintf("[%s]", e.Category)
 	}
-	return fmt.Sprintf("%s %s"+ /*[%s]*/ "%s %v %v",
+	return fmt.Sprintf("%s %s"+ /*[%s]*/ "%s %v%s %v",
 		sTime, LU.EmojiOfLevel(e.Level), // sLvl,
-		sCtg, e.Message, e.CallStack)
+		sCtg, e.Message, FieldsString(e.Fields), e.CallStack)
+}
+
+// FieldsString renders fields as " key=value key=value", for appending
+// to a message. A value that is empty or contains a space, a quote or
+// an "=" is quoted. It returns "" if there are no fields.
+func FieldsString(fields []Field) string {
+	if len(fields) == 0 {
+		return ""
+	}
+	var sb strings.Builder
+	for _, f := range fields {
+		sb.WriteString(" " + f.Key + "=")
+		s := fmt.Sprint(f.Value)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			s = strconv.Quote(s)
+		}
+		sb.WriteString(s)
+	}
+	return sb.String()
 }
 
 // GetCallStack returns the current call stack information as a string.
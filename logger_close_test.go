@@ -0,0 +1,147 @@
+package log_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/fbaube/mlog"
+)
+
+func TestLoggerCloseConcurrently(t *testing.T) {
+	for _, synchronous := range []bool{false, true} {
+		logger := log.NewLogger()
+		logger.Synchronous = synchronous
+		logger.BufferSize = 4
+		target := NewSlowTarget(false)
+		logger.Targets = append(logger.Targets, target)
+		logger.Open()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					logger.Info(fmt.Sprintf("t%d.%d", i, j))
+					logger.SetSubcategory("s")
+					logger.Flush()
+				}
+			}(i)
+		}
+		for i := 0; i < 3; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				logger.Close()
+			}()
+		}
+		wg.Wait()
+		logger.Close()
+		logger.Info("after")
+		logger.Flush()
+	}
+}
+
+func TestLoggerCloseContext(t *testing.T) {
+	logger := log.NewLogger()
+	slow := NewSlowTarget(true)
+	logger.Targets = append(logger.Targets, slow)
+	logger.Open()
+	logger.Info("t1")
+	<-slow.entered
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := logger.CloseContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("CloseContext() = %v, expected %v", err, context.DeadlineExceeded)
+	}
+	logger.Info("t2")
+
+	closed := make(chan bool)
+	go func() {
+		logger.Close()
+		closed <- true
+	}()
+	select {
+	case <-closed:
+		t.Errorf("Close() returned before the target was closed")
+	case <-time.After(20 * time.Millisecond):
+	}
+	close(slow.release)
+	<-closed
+	if result := slow.Messages(); result != "t1" {
+		t.Errorf("target got %q, expected %q", result, "t1")
+	}
+	if err := logger.CloseContext(context.Background()); err != nil {
+		t.Errorf("CloseContext() = %v, expected nil", err)
+	}
+}
+
+func TestLoggerCloseContextWithFullQueue(t *testing.T) {
+	logger := log.NewLogger()
+	logger.BufferSize = 1
+	slow := NewSlowTarget(true)
+	logger.Targets = append(logger.Targets, slow)
+	logger.Open()
+	logger.Info("t1")
+	<-slow.entered // t1 is being processed
+	logger.Info("t2")
+	logged := make(chan bool)
+	go func() {
+		logger.Info("t3") // waits for room in the full queue
+		logged <- true
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	returned := make(chan error)
+	go func() {
+		returned <- logger.CloseContext(ctx)
+	}()
+	select {
+	case err := <-returned:
+		if err != context.DeadlineExceeded {
+			t.Errorf("CloseContext() = %v, expected %v", err, context.DeadlineExceeded)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("CloseContext() did not return when ctx was done")
+	}
+	close(slow.release)
+	<-logged
+	logger.Close()
+	if result := slow.Messages(); result != "t1,t2,t3" {
+		t.Errorf("target got %q, expected %q", result, "t1,t2,t3")
+	}
+}
+
+func TestLoggerOpenAfterClose(t *testing.T) {
+	logger := log.NewLogger()
+	writer := &MemoryWriter{}
+	console := log.NewConsoleTarget()
+	console.Writer = writer
+	console.ColorMode = false
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, console, target)
+	logger = logger.GetLogger("", func(l *log.Logger, e *log.Entry) string {
+		return e.Message
+	})
+
+	for i := 1; i <= 3; i++ {
+		if err := logger.Open(); err != nil {
+			t.Fatalf("Open() #%d: %v", i, err)
+		}
+		logger.Info(fmt.Sprintf("t%d", i))
+		logger.Close()
+		logger.Info("closed")
+	}
+	if result := target.Messages(); result != "t1,t2,t3" {
+		t.Errorf("target got %q, expected %q", result, "t1,t2,t3")
+	}
+	if result := string(writer.bytes); result != "t1\nt2\nt3\n" {
+		t.Errorf("console output = %q, expected %q", result, "t1\nt2\nt3\n")
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	LU "github.com/fbaube/logutils"
 	S "strings"
+	"time"
 )
 
 // DetailsFormatter formats a log message into an appropriate string,
@@ -61,30 +62,49 @@ type DetailsTarget interface {
 
 // CloseLogDetailsBlock(string)
 
-// SetCategory is for DetailsTarget's.
-func (l *coreLogger) SetCategory(s string) {
-	if !l.open {
-		return
-	}
-	for _, target := range l.Targets {
-		dt, OK := target.(DetailsTarget)
-		if OK {
-			dt.SetCategory(s)
-		}
+// startDetails resets the DetailsInfo for a new set of log details.
+func (di *DetailsInfo) startDetails(sCatg string) {
+	di.DoingDetails = true
+	di.MinLogLevel = LU.LevelOkay
+	di.Category = sCatg
+	di.Subcategory = ""
+}
+
+// noteLevel tracks the minimum (i.e. most severe)
+// logging level of the current set of log details.
+func (di *DetailsInfo) noteLevel(lvl LU.Level) {
+	if di.DoingDetails && lvl < di.MinLogLevel {
+		di.MinLogLevel = lvl
 	}
 }
 
-// SetSubcategory is for DetailsTarget's.
+// SetCategory is for DetailsTarget's. It also sets the
+// Category of details blocks started after it. The change
+// travels the entries channel, so that DetailsTarget's see
+// it in order with the messages logged before and after it.
+func (l *coreLogger) SetCategory(s string) {
+	l.ctgLock.Lock()
+	l.category = s
+	l.ctgLock.Unlock()
+	l.control(opSetCategory, s)
+}
+
+// SetSubcategory is for DetailsTarget's. It also sets
+// the Subcategory of entries logged after it. Like
+// SetCategory, it travels the entries channel.
 func (l *coreLogger) SetSubcategory(s string) {
-	if !l.open {
+	l.ctgLock.Lock()
+	l.subcategory = s
+	l.ctgLock.Unlock()
+	l.control(opSetSubcategory, s)
+}
+
+// control queues an operation that is not a log message.
+func (l *coreLogger) control(op entryOp, arg string) {
+	if !l.open.Load() {
 		return
 	}
-	for _, target := range l.Targets {
-		dt, OK := target.(DetailsTarget)
-		if OK {
-			dt.SetSubcategory(s)
-		}
-	}
+	l.enqueue(&Entry{Time: time.Now(), op: op, arg: arg})
 }
 
 // DefaultDetailsFormatter is the default formatter used to format every
@@ -112,11 +132,131 @@ func DefaultDetailsFormatter(l *Logger, e *Entry, spcl []string) string {
 		}
 		sSpcl = " (" + sb.String()[1:] + ") "
 	}
-	return fmt.Sprintf("%s %s%s[%s]%s %v %v",
+	return fmt.Sprintf("%s %s%s[%s]%s %v%s %v",
 		sTime, sSpcl, LU.EmojiOfLevel(e.Level), sLvl, sCtg,
-		e.Message, e.CallStack)
+		e.Message, FieldsString(e.Fields), e.CallStack)
 }
 
-func LogTextQuote(*Entry, string) {
-	panic("LogTextQuote")
+// entryOp is what process() does with an Entry. Operations other than
+// opLog travel the target queues like log messages do, so that they
+// reach the Targets in order with them.
+type entryOp int
+
+const (
+	opLog            entryOp = iota // Process it
+	opStartDetails                  // arg is the Category
+	opEndDetails                    // arg is the summary of the block
+	opQuote                         // arg is the text that is quoted
+	opSetCategory                   // arg is the Category
+	opSetSubcategory                // arg is the Subcategory
+	opReopen                        // for Reopener targets
+	opFlush                         // flushed is done after Flush
+)
+
+// StartDetails starts a set of log details on every DetailsTarget,
+// with summary (at LevelInfo) as the heading of the set. Targets that
+// are not DetailsTarget's just log the summary as a normal message.
+func (l *Logger) StartDetails(summary string) {
+	if !l.open.Load() {
+		return
+	}
+	l.ctgLock.Lock()
+	sCatg := l.category
+	l.ctgLock.Unlock()
+	l.dispatch(&Entry{
+		Category: l.Category,
+		Level:    LU.LevelInfo,
+		Message:  summary,
+		Fields:   l.Fields,
+		Time:     time.Now(),
+		op:       opStartDetails,
+		arg:      sCatg,
+	})
+}
+
+// EndDetails closes the set of log details on every DetailsTarget,
+// which can then write a summary line showing the most severe level
+// in the set. Targets that are not DetailsTarget's ignore it.
+func (l *Logger) EndDetails() {
+	if !l.open.Load() {
+		return
+	}
+	l.dispatch(&Entry{
+		Category: l.Category,
+		Level:    LU.LevelInfo,
+		Fields:   l.Fields,
+		Time:     time.Now(),
+		op:       opEndDetails,
+	})
+}
+
+// Quote logs a message (the title) and a block of text, as an atomic
+// text quote on DetailsTarget's. Targets that are not DetailsTarget's
+// get a normal message that has the text on the lines after the title.
+func (l *Logger) Quote(level LU.Level, title string, text string) {
+	if !l.enabled(level) {
+		return
+	}
+	l.dispatch(&Entry{
+		Category: l.Category,
+		Level:    level,
+		Message:  title,
+		Fields:   l.Fields,
+		Time:     time.Now(),
+		op:       opQuote,
+		arg:      text,
+	})
+}
+
+// deliver hands an entry to a target. A log message (or the nil that
+// signals the close of the logger) goes to Process; details operations
+// go to the DetailsTarget methods, or else fall back to plain lines.
+func (l *coreLogger) deliver(target Target, e *Entry) {
+	if e == nil || e.op == opLog {
+		target.Process(e)
+		return
+	}
+	dt, isDT := target.(DetailsTarget)
+	switch e.op {
+	case opStartDetails:
+		if isDT {
+			dt.StartLogDetailsBlock(e.arg, e)
+		} else {
+			target.Process(e)
+		}
+	case opEndDetails:
+		if isDT {
+			dt.CloseLogDetailsBlock(e.arg)
+		}
+	case opQuote:
+		if isDT {
+			dt.LogTextQuote(e, e.arg)
+		} else {
+			// The text goes in Message too, for targets
+			// that have a Formatter of their own.
+			text := "\n" + S.TrimSuffix(e.arg, "\n")
+			plain := *e
+			plain.op = opLog
+			plain.Message += text
+			plain.FormattedMessage += text
+			target.Process(&plain)
+		}
+	case opSetCategory:
+		if isDT {
+			dt.SetCategory(e.arg)
+		}
+	case opSetSubcategory:
+		if isDT {
+			dt.SetSubcategory(e.arg)
+		}
+	case opFlush:
+		target.Flush()
+		e.flushed.Done()
+	case opReopen:
+		if r, ok := target.(Reopener); ok {
+			if err := r.Reopen(); err != nil {
+				fmt.Fprintf(l.ErrorWriter, "Failed to reopen target: %v\n", err)
+			}
+		}
+	}
 }
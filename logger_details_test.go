@@ -0,0 +1,142 @@
+package log_test
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+// LineTarget is a Target that is not a DetailsTarget.
+type LineTarget struct {
+	lines []string
+	ready chan bool
+}
+
+func (m *LineTarget) Open(io.Writer) error {
+	m.ready = make(chan bool, 0)
+	return nil
+}
+
+func (m *LineTarget) Process(e *log.Entry) {
+	if e == nil {
+		m.ready <- true
+	} else {
+		m.lines = append(m.lines, e.Message+"|"+e.String())
+	}
+}
+
+func (m *LineTarget) Close() {
+	<-m.ready
+}
+
+func (m *LineTarget) Flush() {
+}
+
+func (m *LineTarget) DoesDetails() bool {
+	return false
+}
+
+func TestLoggerDetails(t *testing.T) {
+	logger := log.NewLogger()
+	console := log.NewConsoleTarget()
+	writer := &MemoryWriter{}
+	console.Writer = writer
+	console.ColorMode = false
+	lines := &LineTarget{}
+	logger.Targets = append(logger.Targets, console, lines)
+	logger = logger.GetLogger("", func(l *log.Logger, e *log.Entry) string {
+		return "15.04.05 " + e.Message
+	})
+	logger.Open()
+
+	logger.SetCategory("[01]")
+	logger.StartDetails("t1")
+	logger.Warning("t2")
+	logger.Quote(LU.LevelInfo, "t3", "q1\nq2")
+	logger.EndDetails()
+	logger.Info("t4")
+	logger.Close()
+
+	expected := "15.04.05 t1\n" +
+		" - 04.05 t2\n" +
+		" - 04.05 t3\n" +
+		" \" q1\n" +
+		" \" q2\n" +
+		" = " + LU.EmojiOfLevel(LU.LevelWarning) + " t1\n" +
+		"15.04.05 t4\n"
+	if string(writer.bytes) != expected {
+		t.Errorf("console output = %q, expected %q", writer.bytes, expected)
+	}
+	if console.Category != "[01]" {
+		t.Errorf("console.Category = %q, expected %q", console.Category, "[01]")
+	}
+
+	result := strings.Join(lines.lines, ",")
+	expectedLines := "t1|15.04.05 t1,t2|15.04.05 t2,t3\nq1\nq2|15.04.05 t3\nq1\nq2,t4|15.04.05 t4"
+	if result != expectedLines {
+		t.Errorf("lines = %q, expected %q", result, expectedLines)
+	}
+}
+
+func TestQuoteWithTargetFormatter(t *testing.T) {
+	logFile := filepath.Join(t.TempDir(), "app.jsonl")
+	logger := log.NewLogger()
+	target := log.NewFileTarget()
+	target.FileName = logFile
+	target.Formatter = log.JSONFormatter
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Quote(LU.LevelInfo, "t1", "q1\nq2\n")
+	logger.Close()
+
+	bytes, err := os.ReadFile(logFile)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if !strings.Contains(string(bytes), `"message":"t1\nq1\nq2"`) {
+		t.Errorf("Expected the quoted text in %q", bytes)
+	}
+}
+
+// CategoryTarget records the Category that each message sees.
+type CategoryTarget struct {
+	*log.ConsoleTarget
+	seen []string
+}
+
+func (c *CategoryTarget) Process(e *log.Entry) {
+	if e != nil {
+		c.seen = append(c.seen, c.Category+":"+e.Message)
+	}
+	c.ConsoleTarget.Process(e)
+}
+
+func TestSetCategoryOrder(t *testing.T) {
+	logger := log.NewLogger()
+	target := &CategoryTarget{ConsoleTarget: log.NewConsoleTarget()}
+	target.Writer = &MemoryWriter{}
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+
+	for i := 0; i < 100; i++ {
+		logger.SetCategory(fmt.Sprintf("[%02d]", i))
+		logger.Info("%d", i)
+	}
+	logger.Close()
+
+	if len(target.seen) != 100 {
+		t.Fatalf("len(target.seen) = %v, expected %v", len(target.seen), 100)
+	}
+	for i, s := range target.seen {
+		if expected := fmt.Sprintf("[%02d]:%d", i, i); s != expected {
+			t.Errorf("seen[%d] = %q, expected %q", i, s, expected)
+			break
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package log
+
+import (
+	LU "github.com/fbaube/logutils"
+	"sort"
+	"strings"
+)
+
+// levelTable is the maximum levels of a logger: MaxLevel, and those of
+// CategoryLevels. A table is not changed once it is made, so that Log
+// can read it without a lock; a change of level makes a new one.
+type levelTable struct {
+	maxLevel LU.Level
+	names    map[string]LU.Level
+	prefixes []categoryLevel // the longest prefix first
+}
+
+type categoryLevel struct {
+	prefix string
+	level  LU.Level
+}
+
+// newLevelTable makes a table of the levels. As in Filter.Categories,
+// a category can use "*" as a suffix for wildcard matching.
+func newLevelTable(maxLevel LU.Level, ctgLevels map[string]LU.Level) *levelTable {
+	t := &levelTable{maxLevel: maxLevel, names: make(map[string]LU.Level)}
+	for ctg, lvl := range ctgLevels {
+		if strings.HasSuffix(ctg, "*") {
+			t.prefixes = append(t.prefixes, categoryLevel{ctg[:len(ctg)-1], lvl})
+		} else {
+			t.names[ctg] = lvl
+		}
+	}
+	sort.Slice(t.prefixes, func(i, j int) bool {
+		return len(t.prefixes[i].prefix) > len(t.prefixes[j].prefix)
+	})
+	return t
+}
+
+// levelOf returns the maximum level of a category: its own, or else
+// that of the longest wildcard that matches it, or else maxLevel.
+func (t *levelTable) levelOf(category string) LU.Level {
+	if lvl, ok := t.names[category]; ok {
+		return lvl
+	}
+	for _, p := range t.prefixes {
+		if strings.HasPrefix(category, p.prefix) {
+			return p.level
+		}
+	}
+	return t.maxLevel
+}
+
+// updateLevels makes a new level table of MaxLevel and CategoryLevels.
+// The caller must hold levelLock (or be Open, before logging starts).
+func (l *coreLogger) updateLevels() {
+	l.levels.Store(newLevelTable(l.MaxLevel, l.CategoryLevels))
+}
+
+// SetMaxLevel sets MaxLevel, the maximum level of messages
+// of the categories that are not in CategoryLevels. It can
+// be called while other goroutines are logging.
+func (l *coreLogger) SetMaxLevel(lvl LU.Level) {
+	l.levelLock.Lock()
+	defer l.levelLock.Unlock()
+	l.MaxLevel = lvl
+	l.updateLevels()
+}
+
+// SetCategoryLevel sets the maximum level of messages of a
+// category, which can use "*" as a suffix for wildcard matching,
+// e.g. "db.*". It can be called while other goroutines are logging.
+func (l *coreLogger) SetCategoryLevel(category string, lvl LU.Level) {
+	l.levelLock.Lock()
+	defer l.levelLock.Unlock()
+	// CategoryLevels is copied, not changed, in case it is being read.
+	levels := copyLevels(l.CategoryLevels)
+	levels[category] = lvl
+	l.CategoryLevels = levels
+	l.updateLevels()
+}
+
+// enabled returns whether the logger is open, and whether
+// a message of the level and of the Logger's category is
+// logged. Log calls it before it formats the message.
+func (l *Logger) enabled(level LU.Level) bool {
+	if !l.open.Load() {
+		return false
+	}
+	levels := l.levels.Load()
+	return levels != nil && level <= levels.levelOf(l.Category)
+}
+
+// SetCategoryLevels replaces all of CategoryLevels, e.g. with
+// nil to have MaxLevel apply to every category again. It can
+// be called while other goroutines are logging.
+func (l *coreLogger) SetCategoryLevels(levels map[string]LU.Level) {
+	l.levelLock.Lock()
+	defer l.levelLock.Unlock()
+	l.CategoryLevels = copyLevels(levels)
+	l.updateLevels()
+}
+
+// getLevels returns MaxLevel and (a copy of) CategoryLevels.
+func (l *coreLogger) getLevels() (LU.Level, map[string]LU.Level) {
+	l.levelLock.Lock()
+	defer l.levelLock.Unlock()
+	return l.MaxLevel, copyLevels(l.CategoryLevels)
+}
+
+func copyLevels(levels map[string]LU.Level) map[string]LU.Level {
+	copied := make(map[string]LU.Level, len(levels))
+	for ctg, lvl := range levels {
+		copied[ctg] = lvl
+	}
+	return copied
+}
@@ -0,0 +1,90 @@
+package log_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestLoggerCategoryLevels(t *testing.T) {
+	logger := log.NewLogger()
+	logger.MaxLevel = LU.LevelInfo
+	logger.CategoryLevels = map[string]LU.Level{
+		"db.*":         LU.LevelDebug,
+		"db.pool.*":    LU.LevelWarning,
+		"db.pool.main": LU.LevelInfo,
+	}
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	defer logger.Close()
+
+	logAll := func() string {
+		for _, ctg := range []string{"app", "db.query", "db.pool.x", "db.pool.main"} {
+			l := logger.GetLogger(ctg)
+			l.Debug(ctg + ":d")
+			l.Info(ctg + ":i")
+			l.Warning(ctg + ":w")
+		}
+		logger.Flush()
+		result := target.Messages()
+		target.mu.Lock()
+		target.messages = nil
+		target.mu.Unlock()
+		return result
+	}
+
+	tests := []struct {
+		set      func()
+		expected string
+	}{
+		{func() {},
+			"app:i,app:w,db.query:d,db.query:i,db.query:w,db.pool.x:w,db.pool.main:i,db.pool.main:w,flush"},
+		{func() { logger.SetCategoryLevel("db.pool.*", LU.LevelDebug) },
+			"app:i,app:w,db.query:d,db.query:i,db.query:w,db.pool.x:d,db.pool.x:i,db.pool.x:w,db.pool.main:i,db.pool.main:w,flush"},
+		{func() { logger.SetMaxLevel(LU.LevelWarning) },
+			"app:w,db.query:d,db.query:i,db.query:w,db.pool.x:d,db.pool.x:i,db.pool.x:w,db.pool.main:i,db.pool.main:w,flush"},
+		{func() { log.SetMaxLevel(LU.LevelDebug) },
+			"app:d,app:i,app:w,db.query:d,db.query:i,db.query:w,db.pool.x:d,db.pool.x:i,db.pool.x:w,db.pool.main:i,db.pool.main:w,flush"},
+	}
+	for i, test := range tests {
+		test.set()
+		if result := logAll(); result != test.expected {
+			t.Errorf("test %d: target got %q, expected %q", i, result, test.expected)
+		}
+	}
+	if lvl := logger.CategoryLevels["db.pool.*"]; lvl != LU.LevelDebug {
+		t.Errorf("CategoryLevels[db.pool.*] = %v, expected %v", lvl, LU.LevelDebug)
+	}
+}
+
+func TestLoggerSetLevelsConcurrently(t *testing.T) {
+	logger := log.NewLogger()
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	defer logger.Close()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			l := logger.GetLogger(fmt.Sprintf("c%d", i))
+			for j := 0; j < 100; j++ {
+				l.Info("t")
+			}
+		}(i)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				logger.SetCategoryLevel(fmt.Sprintf("c%d", j%4), LU.Level(j%8))
+				logger.SetMaxLevel(LU.Level(j % 8))
+			}
+		}(i)
+	}
+	wg.Wait()
+}
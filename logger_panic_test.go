@@ -0,0 +1,55 @@
+package log_test
+
+import (
+	"testing"
+
+	log "github.com/fbaube/mlog"
+)
+
+func TestLoggerPanicf(t *testing.T) {
+	logger := log.NewLogger()
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	defer logger.Close()
+
+	func() {
+		defer func() {
+			if r := recover(); r != "t1 failed" {
+				t.Errorf("recovered %v, expected %q", r, "t1 failed")
+			}
+		}()
+		logger.Panicf("%v failed", "t1")
+		t.Errorf("Panicf() did not panic")
+	}()
+	if result := target.Messages(); result != "t1 failed,flush" {
+		t.Errorf("target got %q, expected %q", result, "t1 failed,flush")
+	}
+}
+
+func TestLoggerFatal(t *testing.T) {
+	defer func(exit func(int)) { log.ExitFunc = exit }(log.ExitFunc)
+	var code int
+	var result string
+	logger := log.NewLogger()
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, target)
+	log.ExitFunc = func(c int) {
+		code = c
+		// the targets are closed by now
+		result = target.Messages()
+		logger.Info("t2")
+	}
+	logger.Open()
+
+	logger.Fatal("%v failed", "t1")
+	if code != 1 {
+		t.Errorf("exit code = %v, expected 1", code)
+	}
+	if result != "t1 failed,flush" {
+		t.Errorf("target got %q, expected %q", result, "t1 failed,flush")
+	}
+	if result := target.Messages(); result != "t1 failed,flush" {
+		t.Errorf("target got %q after exit, expected %q", result, "t1 failed,flush")
+	}
+}
@@ -0,0 +1,50 @@
+package log_test
+
+import (
+	"strings"
+	"testing"
+
+	log "github.com/fbaube/mlog"
+)
+
+func TestLoggerWith(t *testing.T) {
+	logger := log.NewLogger()
+	l1 := logger.With("reqID", 7)
+	l2 := l1.GetLogger("system").With("file", "a b.xml", 42)
+	if len(logger.Fields) != 0 {
+		t.Errorf("len(logger.Fields) = %v, expected %v", len(logger.Fields), 0)
+	}
+	if len(l1.Fields) != 1 {
+		t.Errorf("len(l1.Fields) = %v, expected %v", len(l1.Fields), 1)
+	}
+	if l2.Category != "system" {
+		t.Errorf("l2.Category = %v, expected %v", l2.Category, "system")
+	}
+	s := log.FieldsString(l2.Fields)
+	expected := ` reqID=7 file="a b.xml" !BADKEY=42`
+	if s != expected {
+		t.Errorf("FieldsString(l2.Fields) = %q, expected %q", s, expected)
+	}
+}
+
+func TestLoggerWithOutput(t *testing.T) {
+	logger := log.NewLogger()
+	target := &ConsoleTargetMock{
+		done:          make(chan bool, 0),
+		ConsoleTarget: log.NewConsoleTarget(),
+	}
+	writer := &MemoryWriter{}
+	target.Writer = writer
+	target.ColorMode = false
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+
+	logger.With("reqID", 7).Info("t1")
+
+	logger.Close()
+	<-target.done
+
+	if !strings.Contains(string(writer.bytes), "t1 reqID=7") {
+		t.Errorf("Expected %q not found in %q", "t1 reqID=7", writer.bytes)
+	}
+}
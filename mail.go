@@ -5,12 +5,16 @@
 package log
 
 import (
+	"crypto/tls"
 	"errors"
 	"fmt"
 	LU "github.com/fbaube/logutils"
 	"io"
-	"net/smtp"
+	"os"
 	"strings"
+	"sync"
+	"text/template"
+	"time"
 )
 
 // MailTarget sends log messages in emails via an SMTP server.
@@ -19,24 +23,64 @@ type MailTarget struct {
 	Host       string   // SMTP server address
 	Username   string   // SMTP server login username
 	Password   string   // SMTP server login password
-	Subject    string   // the mail subject
+	Subject    string   // the mail subject, a template (see MailSubject)
 	Sender     string   // the mail sender
-	Recipients []string // the mail recipients
+	Recipients []string // the mail recipients (of messages that no Route matches)
 	BufferSize int      // the size of the message channel.
+	// the recipients by level and category: a message goes to the
+	// Recipients of every route whose Filter allows it (or if none
+	// does, to the MailTarget's Recipients).
+	Routes []MailRoute
+	// whether to connect with TLS from the start (SMTPS, usually
+	// on port 465), rather than in plain text.
+	ImplicitTLS bool
+	// whether STARTTLS is required. If not, it is still
+	// used if the server supports it.
+	StartTLS bool
+	// the TLS configuration for ImplicitTLS and STARTTLS. If it is
+	// nil, the system's CA certificates are used.
+	TLSConfig *tls.Config
+	// how to log in: "PLAIN", "CRAM-MD5" or "NONE". If it is empty,
+	// PLAIN is used if Username is set, and otherwise NONE.
+	AuthMethod string
+	// whether to add an HTML alternative to the plain text of the
+	// email, with the messages as formatted by HtmlFormatter.
+	HTML bool
+	// how long to collect messages, after the first one, before
+	// sending them in one digest email. Zero means no batching,
+	// i.e. every message is sent in an email of its own.
+	BatchWindow time.Duration
+	// maximum number of messages in a digest; a full batch is sent
+	// at once. Zero means no limit.
+	BatchSize int
+	// maximum number of emails sent per hour. Messages that come
+	// while the limit is reached are held in the batch (but beyond
+	// BatchSize, they are only counted) until an email can be sent.
+	// Zero means no limit.
+	MaxEmailsPerHour int
 
-	entries chan *Entry
-	close   chan bool
+	entries  chan *Entry
+	close    chan bool
+	batches  map[string]*mailBatch // by recipients
+	sent     []time.Time           // when the emails of the past hour were sent
+	subject  *template.Template
+	hostname string
 }
 
 // NewMailTarget creates a MailTarget.
 // The new MailTarget takes these default options:
-// MaxLevel: LevelDbg, BufferSize: 1024.
-// You must specify these fields: Host, Username, Subject, Sender, and Recipients.
+// MaxLevel: LevelDbg, BufferSize: 1024, BatchWindow: 1m,
+// BatchSize: 100, MaxEmailsPerHour: 60.
+// You must specify these fields: Host, Subject, Sender, and Recipients
+// (and Username and Password, if the SMTP server requires a login).
 func NewMailTarget() *MailTarget {
 	return &MailTarget{
-		Filter:     &Filter{MaxLevel: LU.LevelDebug},
-		BufferSize: 1024,
-		close:      make(chan bool, 0),
+		Filter:           &Filter{MaxLevel: LU.LevelDebug},
+		BufferSize:       1024,
+		BatchWindow:      time.Minute,
+		BatchSize:        100,
+		MaxEmailsPerHour: 60,
+		close:            make(chan bool, 0),
 	}
 }
 
@@ -46,22 +90,55 @@ func (t *MailTarget) Open(errWriter io.Writer) error {
 	if t.Host == "" {
 		return errors.New("MailTarget.Host must be specified")
 	}
-	if t.Username == "" {
-		return errors.New("MailTarget.Username must be specified")
+	switch strings.ToUpper(t.AuthMethod) {
+	case "":
+	case "PLAIN", "CRAM-MD5":
+		if t.Username == "" {
+			return errors.New("MailTarget.Username must be specified")
+		}
+	case "NONE":
+	default:
+		return fmt.Errorf("MailTarget.AuthMethod is invalid: %q", t.AuthMethod)
+	}
+	if t.ImplicitTLS && t.StartTLS {
+		return errors.New("MailTarget.ImplicitTLS and MailTarget.StartTLS cannot both be set")
 	}
 	if t.Subject == "" {
 		return errors.New("MailTarget.Subject must be specified")
 	}
+	subject, err := template.New("subject").Parse(t.Subject)
+	if err != nil {
+		return fmt.Errorf("MailTarget.Subject is invalid: %v", err)
+	}
+	t.subject = subject
+	t.hostname, _ = os.Hostname()
 	if t.Sender == "" {
 		return errors.New("MailTarget.Sender must be specified")
 	}
-	if len(t.Recipients) == 0 {
-		return errors.New("MailTarget.Recipients must be specified")
+	if len(t.Recipients) == 0 && len(t.Routes) == 0 {
+		return errors.New("MailTarget.Recipients or MailTarget.Routes must be specified")
+	}
+	for _, route := range t.Routes {
+		if route.Filter == nil || len(route.Recipients) == 0 {
+			return errors.New("MailTarget.Routes must each have a Filter and Recipients")
+		}
+		route.Filter.Init()
 	}
 	if t.BufferSize < 0 {
 		return errors.New("MailTarget.BufferSize must be no less than 0")
 	}
+	if t.BatchWindow < 0 {
+		return errors.New("MailTarget.BatchWindow must be no less than 0")
+	}
+	if t.BatchSize < 0 {
+		return errors.New("MailTarget.BatchSize must be no less than 0")
+	}
+	if t.MaxEmailsPerHour < 0 {
+		return errors.New("MailTarget.MaxEmailsPerHour must be no less than 0")
+	}
 	t.entries = make(chan *Entry, t.BufferSize)
+	t.batches = make(map[string]*mailBatch)
+	t.sent = nil
 
 	go t.sendMessages(errWriter)
 
@@ -71,10 +148,9 @@ func (t *MailTarget) Open(errWriter io.Writer) error {
 // Process puts filtered log messages into a channel for sending in emails.
 func (t *MailTarget) Process(e *Entry) {
 	if t.Allow(e) {
-		select {
-		case t.entries <- e:
-		default:
-		}
+		// If the channel is full, this waits, and the logger's
+		// Overflow policy decides what to do with what follows.
+		t.entries <- e
 	}
 }
 
@@ -83,9 +159,15 @@ func (t *MailTarget) Close() {
 	<-t.close
 }
 
-// Flush is a no-op.
+// Flush waits until the messages in the channel have been added to
+// their batches, and until the batches that are due have been sent.
+// Unlike Close, it does not send batches early, so BatchWindow and
+// MaxEmailsPerHour still hold.
 func (t *MailTarget) Flush() {
-	// <-t.close
+	var flushed sync.WaitGroup
+	flushed.Add(1)
+	t.entries <- &Entry{Time: time.Now(), op: opFlush, flushed: &flushed}
+	flushed.Wait()
 }
 
 func (t *MailTarget) DoesDetails() bool {
@@ -93,30 +175,44 @@ func (t *MailTarget) DoesDetails() bool {
 }
 
 func (t *MailTarget) sendMessages(errWriter io.Writer) {
-	auth := smtp.PlainAuth(
-		"",
-		t.Username,
-		t.Password,
-		strings.Split(t.Host, ":")[0],
-	)
+	auth := t.makeAuth()
+	var timer *time.Timer
 	for {
-		entry := <-t.entries
-		if entry == nil {
-			t.close <- true
-			break
+		var flushed *sync.WaitGroup
+		// The timer is set for when the next batch is due.
+		var due <-chan time.Time
+		if timer != nil {
+			due = timer.C
+		}
+		select {
+		case <-due:
+		case entry := <-t.entries:
+			if entry == nil {
+				if timer != nil {
+					timer.Stop()
+				}
+				// A final flush, whatever the rate limit.
+				for _, b := range t.pendingBatches() {
+					t.sendBatch(errWriter, auth, b)
+				}
+				t.close <- true
+				return
+			}
+			if entry.op == opFlush {
+				flushed = entry.flushed
+			} else {
+				t.addToBatch(entry)
+			}
 		}
-		if err := t.write(auth, entry.String()+"\n"); err != nil {
-			fmt.Fprintf(errWriter, "MailTarget write error: %v\n", err)
+		if timer != nil {
+			timer.Stop()
+			timer = nil
+		}
+		if next, ok := t.sendDueBatches(errWriter, auth); ok {
+			timer = time.NewTimer(time.Until(next))
+		}
+		if flushed != nil {
+			flushed.Done()
 		}
 	}
 }
-
-func (t *MailTarget) write(auth smtp.Auth, message string) error {
-	msg := fmt.Sprintf("To: %v\r\nFrom: %v\r\nSubject: %v\r\nContent-Type: text/plain; charset=UTF-8\r\n\r\n%v",
-		strings.Join(t.Recipients, ";"),
-		t.Sender,
-		t.Subject,
-		message,
-	)
-	return smtp.SendMail(t.Host, auth, t.Sender, t.Recipients, []byte(msg))
-}
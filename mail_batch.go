@@ -0,0 +1,193 @@
+package log
+
+import (
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	"io"
+	"net/smtp"
+	"sort"
+	S "strings"
+	"time"
+)
+
+// mailBatch is the messages that MailTarget collects for a digest.
+type mailBatch struct {
+	key        string // of the recipients, in MailTarget.batches
+	recipients []string
+	started    time.Time
+	entries    []*Entry
+	omitted    int // messages beyond BatchSize, which are only counted
+	levels     map[LU.Level]int
+	categories map[string]int
+}
+
+func newMailBatch(key string, recipients []string, started time.Time) *mailBatch {
+	return &mailBatch{
+		key:        key,
+		recipients: recipients,
+		started:    started,
+		levels:     make(map[LU.Level]int),
+		categories: make(map[string]int),
+	}
+}
+
+// add adds an entry, or only counts it if the batch has max messages.
+func (b *mailBatch) add(e *Entry, max int) {
+	b.levels[e.Level]++
+	b.categories[e.Category]++
+	if max > 0 && len(b.entries) >= max {
+		b.omitted++
+		return
+	}
+	b.entries = append(b.entries, e)
+}
+
+func (b *mailBatch) count() int {
+	return len(b.entries) + b.omitted
+}
+
+// summary is the header of a digest, e.g.
+// "3 messages: Error 2, Warning 1\nCategories: app 2, db 1\n".
+func (b *mailBatch) summary() string {
+	var levels []LU.Level
+	for lvl := range b.levels {
+		levels = append(levels, lvl)
+	}
+	sort.Slice(levels, func(i, j int) bool { return levels[i] < levels[j] })
+	var counts []string
+	for _, lvl := range levels {
+		counts = append(counts, fmt.Sprintf("%v %d", lvl, b.levels[lvl]))
+	}
+	s := fmt.Sprintf("%d messages: %s\n", b.count(), S.Join(counts, ", "))
+
+	var ctgs []string
+	for ctg := range b.categories {
+		ctgs = append(ctgs, ctg)
+	}
+	sort.Strings(ctgs)
+	counts = counts[:0]
+	for _, ctg := range ctgs {
+		name := ctg
+		if name == "" {
+			name = "(none)"
+		}
+		counts = append(counts, fmt.Sprintf("%s %d", name, b.categories[ctg]))
+	}
+	return s + "Categories: " + S.Join(counts, ", ") + "\n"
+}
+
+// addToBatch adds an entry to the batch of its recipients.
+// It is dropped if it has none.
+func (t *MailTarget) addToBatch(e *Entry) {
+	recipients := t.recipientsOf(e)
+	if len(recipients) == 0 {
+		return
+	}
+	sorted := append([]string(nil), recipients...)
+	sort.Strings(sorted)
+	key := S.Join(sorted, ",")
+	b := t.batches[key]
+	if b == nil {
+		b = newMailBatch(key, recipients, time.Now())
+		t.batches[key] = b
+	}
+	b.add(e, t.BatchSize)
+}
+
+// pendingBatches returns the batches, oldest first.
+func (t *MailTarget) pendingBatches() []*mailBatch {
+	var batches []*mailBatch
+	for _, b := range t.batches {
+		batches = append(batches, b)
+	}
+	sort.Slice(batches, func(i, j int) bool {
+		return batches[i].started.Before(batches[j].started)
+	})
+	return batches
+}
+
+// sendDueBatches sends the batches that are due, and
+// returns when the next one is due, if there is one.
+func (t *MailTarget) sendDueBatches(errWriter io.Writer, auth smtp.Auth) (next time.Time, ok bool) {
+	for _, b := range t.pendingBatches() {
+		due := t.dueTime(b)
+		if !due.After(time.Now()) {
+			t.sendBatch(errWriter, auth, b)
+		} else if !ok || due.Before(next) {
+			next, ok = due, true
+		}
+	}
+	return next, ok
+}
+
+// dueTime returns when a batch should be sent: when it is full or
+// its BatchWindow is over, but not before MaxEmailsPerHour allows.
+func (t *MailTarget) dueTime(b *mailBatch) time.Time {
+	due := b.started.Add(t.BatchWindow)
+	if t.BatchSize > 0 && b.count() >= t.BatchSize {
+		due = b.started
+	}
+	if t.MaxEmailsPerHour > 0 {
+		hourAgo := time.Now().Add(-time.Hour)
+		for len(t.sent) > 0 && !t.sent[0].After(hourAgo) {
+			t.sent = t.sent[1:]
+		}
+		if len(t.sent) >= t.MaxEmailsPerHour {
+			if next := t.sent[0].Add(time.Hour); next.After(due) {
+				due = next
+			}
+		}
+	}
+	return due
+}
+
+// sendBatch sends a batch, as a digest if it has more than one message.
+func (t *MailTarget) sendBatch(errWriter io.Writer, auth smtp.Auth, b *mailBatch) {
+	delete(t.batches, b.key)
+	t.sent = append(t.sent, time.Now())
+	subject := t.subjectOf(errWriter, b)
+	if b.count() > 1 {
+		subject = fmt.Sprintf("%s (%d messages)", subject, b.count())
+	}
+	var html string
+	if t.HTML {
+		html = b.html()
+	}
+	if err := t.write(auth, b.recipients, subject, b.text(), html); err != nil {
+		fmt.Fprintf(errWriter, "MailTarget write error: %v\n", err)
+	}
+}
+
+// text is the plain text body of the email: the message, or a digest.
+func (b *mailBatch) text() string {
+	if b.count() == 1 {
+		return b.entries[0].String() + "\n"
+	}
+	var sb S.Builder
+	sb.WriteString(b.summary() + "\n")
+	for _, e := range b.entries {
+		sb.WriteString(e.String() + "\n")
+	}
+	if b.omitted > 0 {
+		fmt.Fprintf(&sb, "(%d more messages were not included)\n", b.omitted)
+	}
+	return sb.String()
+}
+
+// html is the HTML body of the email, with the messages
+// as formatted by HtmlFormatter.
+func (b *mailBatch) html() string {
+	var sb S.Builder
+	sb.WriteString("<!DOCTYPE html>\n<html><head>\n" + HtmlStyle + "</head><body>\n")
+	if b.count() > 1 {
+		sb.WriteString("<p>" + htmlSpan(S.TrimSuffix(b.summary(), "\n"), 0) + "</p>\n")
+	}
+	for _, e := range b.entries {
+		sb.WriteString(e.Format(HtmlFormatter) + "\n")
+	}
+	if b.omitted > 0 {
+		fmt.Fprintf(&sb, "<p>(%d more messages were not included)</p>\n", b.omitted)
+	}
+	sb.WriteString("</body></html>\n")
+	return sb.String()
+}
@@ -0,0 +1,81 @@
+package log
+
+import (
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	"io"
+	S "strings"
+)
+
+// MailRoute sends the messages that its Filter allows (by level and
+// category) to its Recipients. For example, to page on-call for a
+// panic, while warnings (and worse) of the database go to its team:
+//
+//	t.Routes = []log.MailRoute{
+//		{&log.Filter{MaxLevel: LU.LevelPanic}, []string{"oncall@example.com"}},
+//		{&log.Filter{MaxLevel: LU.LevelWarning, Categories: []string{"db.*"}},
+//			[]string{"db-team@example.com"}},
+//	}
+type MailRoute struct {
+	*Filter
+	Recipients []string
+}
+
+// MailSubject is what a MailTarget.Subject template can use, e.g.
+// "{{.Level}} on {{.Hostname}}: {{.FirstLine}}". In a digest, it is
+// of the most severe message, and " (N messages)" is appended.
+type MailSubject struct {
+	Level     LU.Level
+	Category  string
+	FirstLine string // of the message
+	Hostname  string
+	Count     int // the number of messages in the email
+}
+
+// recipientsOf returns the recipients of the routes
+// that allow the entry, or else the Recipients.
+func (t *MailTarget) recipientsOf(e *Entry) []string {
+	var recipients []string
+	seen := make(map[string]bool)
+	for _, route := range t.Routes {
+		if !route.Allow(e) {
+			continue
+		}
+		for _, rcpt := range route.Recipients {
+			if !seen[rcpt] {
+				seen[rcpt] = true
+				recipients = append(recipients, rcpt)
+			}
+		}
+	}
+	if len(recipients) == 0 {
+		return t.Recipients
+	}
+	return recipients
+}
+
+// subjectOf executes the Subject template for a batch. If that
+// fails, the error is reported, and the template itself is used.
+func (t *MailTarget) subjectOf(errWriter io.Writer, b *mailBatch) string {
+	e := b.entries[0]
+	for _, entry := range b.entries[1:] {
+		if entry.Level < e.Level {
+			e = entry
+		}
+	}
+	firstLine, _, _ := S.Cut(e.Message, "\n")
+	var sb S.Builder
+	err := t.subject.Execute(&sb, MailSubject{
+		Level:     e.Level,
+		Category:  e.Category,
+		FirstLine: S.TrimSpace(firstLine),
+		Hostname:  t.hostname,
+		Count:     b.count(),
+	})
+	if err != nil {
+		fmt.Fprintf(errWriter, "MailTarget subject error: %v\n", err)
+		return t.Subject
+	}
+	// A header cannot have newlines.
+	return S.Join(S.Fields(sb.String()), " ")
+}
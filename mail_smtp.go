@@ -0,0 +1,201 @@
+package log
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	S "strings"
+	"time"
+)
+
+// mailTimeout limits how long sending one email can take.
+const mailTimeout = time.Minute
+
+// host returns the host name of the SMTP server, without the port.
+func (t *MailTarget) host() string {
+	host, _, err := net.SplitHostPort(t.Host)
+	if err != nil {
+		return t.Host
+	}
+	return host
+}
+
+// makeAuth returns the smtp.Auth of AuthMethod, or nil for none.
+func (t *MailTarget) makeAuth() smtp.Auth {
+	switch S.ToUpper(t.AuthMethod) {
+	case "NONE":
+		return nil
+	case "CRAM-MD5":
+		return smtp.CRAMMD5Auth(t.Username, t.Password)
+	case "":
+		if t.Username == "" {
+			return nil
+		}
+	}
+	return smtp.PlainAuth("", t.Username, t.Password, t.host())
+}
+
+// write sends an email: the text, with the html as an
+// alternative to it (unless it is empty).
+func (t *MailTarget) write(auth smtp.Auth, recipients []string, subject, text, html string) error {
+	msg, err := t.compose(recipients, subject, text, html)
+	if err != nil {
+		return err
+	}
+	tlsConfig := &tls.Config{ServerName: t.host()}
+	if t.TLSConfig != nil {
+		tlsConfig = t.TLSConfig.Clone()
+		if tlsConfig.ServerName == "" {
+			tlsConfig.ServerName = t.host()
+		}
+	}
+
+	dialer := &net.Dialer{Timeout: mailTimeout}
+	var conn net.Conn
+	if t.ImplicitTLS {
+		conn, err = tls.DialWithDialer(dialer, "tcp", t.Host, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", t.Host)
+	}
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(mailTimeout))
+	c, err := smtp.NewClient(conn, t.host())
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if !t.ImplicitTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err = c.StartTLS(tlsConfig); err != nil {
+				return err
+			}
+		} else if t.StartTLS {
+			return errors.New("the SMTP server does not support STARTTLS")
+		}
+	}
+	if auth != nil {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errors.New("the SMTP server does not support AUTH")
+		}
+		if err = c.Auth(auth); err != nil {
+			return err
+		}
+	}
+	if err = c.Mail(mailAddress(t.Sender)); err != nil {
+		return err
+	}
+	for _, rcpt := range recipients {
+		if err = c.Rcpt(mailAddress(rcpt)); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// compose makes an RFC 5322 email, whose body is the text
+// (quoted-printable), or if html is not empty, a multipart
+// alternative of the text and the html.
+func (t *MailTarget) compose(recipients []string, subject, text, html string) ([]byte, error) {
+	var to []string
+	for _, rcpt := range recipients {
+		to = append(to, mailHeaderAddress(rcpt))
+	}
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", mailHeaderAddress(t.Sender))
+	fmt.Fprintf(&buf, "To: %s\r\n", S.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("UTF-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "Message-ID: %s\r\n", t.messageID())
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	if html == "" {
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n" +
+			"Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		err := writeQuotedPrintable(&buf, text)
+		return buf.Bytes(), err
+	}
+	mw := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/alternative; boundary=%q\r\n\r\n", mw.Boundary())
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=UTF-8", text},
+		{"text/html; charset=UTF-8", html},
+	} {
+		w, err := mw.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		if err = writeQuotedPrintable(w, part.body); err != nil {
+			return nil, err
+		}
+	}
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+func writeQuotedPrintable(w io.Writer, s string) error {
+	qw := quotedprintable.NewWriter(w)
+	if _, err := io.WriteString(qw, s); err != nil {
+		return err
+	}
+	return qw.Close()
+}
+
+// messageID makes a unique Message-ID in the domain of the Sender.
+func (t *MailTarget) messageID() string {
+	domain := mailAddress(t.Sender)
+	if i := S.LastIndex(domain, "@"); i >= 0 {
+		domain = domain[i+1:]
+	} else if domain, _ = os.Hostname(); domain == "" {
+		domain = "localhost"
+	}
+	var r [8]byte
+	rand.Read(r[:])
+	return fmt.Sprintf("<%d.%x@%s>", time.Now().UnixNano(), r, domain)
+}
+
+// mailAddress returns the bare address of e.g. "Ops <ops@example.com>".
+func mailAddress(s string) string {
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return addr.Address
+	}
+	return s
+}
+
+// mailHeaderAddress returns an address as it goes in a header,
+// with its name (if any) encoded.
+func mailHeaderAddress(s string) string {
+	if addr, err := mail.ParseAddress(s); err == nil {
+		return addr.String()
+	}
+	return s
+}
@@ -5,8 +5,22 @@
 package log_test
 
 import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
+	LU "github.com/fbaube/logutils"
 	log "github.com/fbaube/mlog"
 )
 
@@ -16,3 +30,459 @@ func TestNewMailTarget(t *testing.T) {
 		t.Errorf("NewMailTarget.MaxLevel = %v, expected %v", target.MaxLevel, log.LevelDbg)
 	}
 }
+
+// FakeSMTPServer is an SMTP server that keeps the emails that it gets.
+type FakeSMTPServer struct {
+	// if set, STARTTLS is supported (or with Implicit, TLS is used
+	// from the start)
+	TLSConfig *tls.Config
+	Implicit  bool
+	// the AUTH mechanism that is supported; empty means PLAIN
+	AuthMechanism string
+
+	listener net.Listener
+	mu       sync.Mutex
+	mails    []string
+	logins   []string // "PLAIN" or "CRAM-MD5 <username>", and " TLS" if so
+}
+
+func (s *FakeSMTPServer) Start(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Implicit {
+		listener = tls.NewListener(listener, s.TLSConfig)
+	}
+	s.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+}
+
+func (s *FakeSMTPServer) Address() string {
+	return s.listener.Addr().String()
+}
+
+func (s *FakeSMTPServer) Close() {
+	s.listener.Close()
+}
+
+func (s *FakeSMTPServer) serve(conn net.Conn) {
+	defer func() { conn.Close() }()
+	_, secure := conn.(*tls.Conn)
+	r := textproto.NewConn(conn)
+	r.PrintfLine("220 localhost ESMTP")
+	mechanism := s.AuthMechanism
+	if mechanism == "" {
+		mechanism = "PLAIN"
+	}
+	for {
+		line, err := r.ReadLine()
+		if err != nil {
+			return
+		}
+		args := strings.Split(line, " ")
+		switch strings.ToUpper(args[0]) {
+		case "EHLO":
+			r.PrintfLine("250-localhost")
+			if s.TLSConfig != nil && !secure {
+				r.PrintfLine("250-STARTTLS")
+			}
+			r.PrintfLine("250 AUTH " + mechanism)
+		case "STARTTLS":
+			r.PrintfLine("220 Ready to start TLS")
+			conn = tls.Server(conn, s.TLSConfig)
+			r = textproto.NewConn(conn)
+			secure = true
+		case "AUTH":
+			login := args[1]
+			if login == "CRAM-MD5" {
+				r.PrintfLine("334 " + base64.StdEncoding.EncodeToString([]byte("<1.2@localhost>")))
+				resp, _ := r.ReadLine()
+				decoded, _ := base64.StdEncoding.DecodeString(resp)
+				login += " " + strings.Split(string(decoded), " ")[0]
+			}
+			if secure {
+				login += " TLS"
+			}
+			s.mu.Lock()
+			s.logins = append(s.logins, login)
+			s.mu.Unlock()
+			r.PrintfLine("235 OK")
+		case "DATA":
+			r.PrintfLine("354 Go ahead")
+			data, err := r.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.mails = append(s.mails, string(data))
+			s.mu.Unlock()
+			r.PrintfLine("250 OK")
+		case "QUIT":
+			r.PrintfLine("221 Bye")
+			return
+		default:
+			r.PrintfLine("250 OK")
+		}
+	}
+}
+
+// Mails waits up to a second for n emails, and returns those that came.
+func (s *FakeSMTPServer) Mails(n int) []string {
+	for i := 0; i < 100; i++ {
+		s.mu.Lock()
+		count := len(s.mails)
+		s.mu.Unlock()
+		if count >= n {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.mails...)
+}
+
+func newTestMailTarget(server *FakeSMTPServer) *log.MailTarget {
+	target := log.NewMailTarget()
+	target.Host = server.Address()
+	target.Username = "user"
+	target.Password = "pass"
+	target.Subject = "Log"
+	target.Sender = "app@example.com"
+	target.Recipients = []string{"ops@example.com"}
+	return target
+}
+
+func TestMailTargetBatch(t *testing.T) {
+	server := &FakeSMTPServer{}
+	server.Start(t)
+	defer server.Close()
+
+	logger := log.NewLogger()
+	target := newTestMailTarget(server)
+	target.BatchWindow = time.Hour
+	target.BatchSize = 3
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Error("t1")
+	logger.GetLogger("db").Warning("t2")
+	logger.Error("t3")
+	// The batch is full, and sent at once.
+	mails := server.Mails(1)
+	if len(mails) != 1 {
+		t.Fatalf("got %d emails, expected 1", len(mails))
+	}
+	for _, s := range []string{"Subject: Log (3 messages)",
+		"3 messages: " + LU.LevelError.String() + " 2, " + LU.LevelWarning.String() + " 1\n",
+		"Categories: (none) 2, db 1\n", "t1", "t2", "t3"} {
+		if !strings.Contains(mails[0], s) {
+			t.Errorf("email %q does not contain %q", mails[0], s)
+		}
+	}
+	// The rest is sent on Close.
+	logger.Info("t4")
+	logger.Close()
+	mails = server.Mails(2)
+	if len(mails) != 2 || !strings.Contains(mails[1], "Subject: Log\n") ||
+		!strings.Contains(mails[1], "t4") {
+		t.Errorf("emails = %q, expected a second one with t4", mails)
+	}
+}
+
+func TestMailTargetOverflow(t *testing.T) {
+	server := &FakeSMTPServer{}
+	server.Start(t)
+	defer server.Close()
+
+	// With no room in its channel, the target waits for its goroutine
+	// rather than drops messages; the logger's Overflow policy decides.
+	logger := log.NewLogger()
+	target := newTestMailTarget(server)
+	target.BufferSize = 0
+	target.BatchWindow = time.Hour
+	target.BatchSize = 0
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	for i := 0; i < 50; i++ {
+		logger.Error("t%d", i)
+	}
+	logger.Close()
+	mails := server.Mails(1)
+	if len(mails) != 1 || !strings.Contains(mails[0], "Subject: Log (50 messages)") {
+		t.Errorf("emails = %q, expected one of 50 messages", mails)
+	}
+	if n := logger.Dropped(); n != 0 {
+		t.Errorf("logger.Dropped() = %v, expected 0", n)
+	}
+}
+
+func TestMailTargetFlush(t *testing.T) {
+	server := &FakeSMTPServer{}
+	server.Start(t)
+	defer server.Close()
+
+	logger := log.NewLogger()
+	target := newTestMailTarget(server)
+	target.BatchWindow = 0
+	target.MaxEmailsPerHour = 1
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	// The batch that is due is sent by Flush, before it returns.
+	logger.Error("t1")
+	logger.Flush()
+	if mails := server.Mails(0); len(mails) != 1 {
+		t.Errorf("got %d emails, expected 1", len(mails))
+	}
+	// Flush does not send batches early, whatever the rate limit.
+	for i := 2; i <= 5; i++ {
+		logger.Error("t%d", i)
+		logger.Flush()
+	}
+	if mails := server.Mails(0); len(mails) != 1 {
+		t.Errorf("got %d emails, expected 1 within the rate limit", len(mails))
+	}
+	logger.Close()
+	mails := server.Mails(2)
+	if len(mails) != 2 || !strings.Contains(mails[1], "Subject: Log (4 messages)") {
+		t.Errorf("emails = %q, expected a last one of 4 messages", mails)
+	}
+}
+
+func TestMailTargetRateLimit(t *testing.T) {
+	server := &FakeSMTPServer{}
+	server.Start(t)
+	defer server.Close()
+
+	logger := log.NewLogger()
+	target := newTestMailTarget(server)
+	target.BatchWindow = 0
+	target.BatchSize = 2
+	target.MaxEmailsPerHour = 1
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Error("t1")
+	if mails := server.Mails(1); len(mails) != 1 {
+		t.Fatalf("got %d emails, expected 1", len(mails))
+	}
+	// These are held, and beyond BatchSize only counted.
+	logger.Error("t2")
+	logger.Error("t3")
+	logger.Error("t4")
+	time.Sleep(50 * time.Millisecond)
+	if mails := server.Mails(0); len(mails) != 1 {
+		t.Errorf("got %d emails, expected 1 within the rate limit", len(mails))
+	}
+	logger.Close()
+	mails := server.Mails(2)
+	if len(mails) != 2 {
+		t.Fatalf("got %d emails, expected 2", len(mails))
+	}
+	for _, s := range []string{"Subject: Log (3 messages)", "t2", "t3",
+		"(1 more messages were not included)"} {
+		if !strings.Contains(mails[1], s) {
+			t.Errorf("email %q does not contain %q", mails[1], s)
+		}
+	}
+}
+
+func TestMailTargetTransport(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	cert := newTestCert(t, dir, "server", ca)
+	pair, err := tls.LoadX509KeyPair(cert.certFile, cert.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConfig := &tls.Config{Certificates: []tls.Certificate{pair}}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+
+	tests := []struct {
+		name        string
+		tlsConfig   *tls.Config // of the server
+		implicit    bool
+		mechanism   string
+		authMethod  string
+		username    string
+		startTLS    bool
+		expected    string // the login, or "" if none
+		expectedErr bool
+	}{
+		{"plain", nil, false, "", "", "user", false, "PLAIN", false},
+		{"no auth", nil, false, "", "", "", false, "", false},
+		{"none", nil, false, "", "NONE", "user", false, "", false},
+		{"cram-md5", nil, false, "CRAM-MD5", "cram-md5", "user", false, "CRAM-MD5 user", false},
+		{"opportunistic STARTTLS", serverConfig, false, "", "", "user", false, "PLAIN TLS", false},
+		{"required STARTTLS", serverConfig, false, "", "", "user", true, "PLAIN TLS", false},
+		{"unsupported STARTTLS", nil, false, "", "", "user", true, "", true},
+		{"implicit TLS", serverConfig, true, "", "", "user", false, "PLAIN TLS", false},
+	}
+	for _, test := range tests {
+		server := &FakeSMTPServer{
+			TLSConfig:     test.tlsConfig,
+			Implicit:      test.implicit,
+			AuthMechanism: test.mechanism,
+		}
+		server.Start(t)
+
+		logger := log.NewLogger()
+		errWriter := &MemoryWriter{}
+		logger.ErrorWriter = errWriter
+		target := newTestMailTarget(server)
+		target.Username = test.username
+		target.AuthMethod = test.authMethod
+		target.StartTLS = test.startTLS
+		target.ImplicitTLS = test.implicit
+		target.TLSConfig = &tls.Config{RootCAs: pool}
+		target.BatchWindow = 0
+		logger.Targets = append(logger.Targets, target)
+		logger.Open()
+		logger.Error("t1")
+		logger.Close()
+		server.Close()
+
+		n := 1
+		if test.expectedErr {
+			n = 0
+			if len(errWriter.bytes) == 0 {
+				t.Errorf("%v: expected an error", test.name)
+			}
+		} else if len(errWriter.bytes) > 0 {
+			t.Errorf("%v: error %q", test.name, errWriter.bytes)
+		}
+		if mails := server.Mails(n); len(mails) != n {
+			t.Errorf("%v: got %d emails, expected %d", test.name, len(mails), n)
+		}
+		server.mu.Lock()
+		logins := strings.Join(server.logins, ",")
+		server.mu.Unlock()
+		if logins != test.expected {
+			t.Errorf("%v: login = %q, expected %q", test.name, logins, test.expected)
+		}
+	}
+}
+
+func TestMailTargetMIME(t *testing.T) {
+	server := &FakeSMTPServer{}
+	server.Start(t)
+	defer server.Close()
+
+	logger := log.NewLogger()
+	target := newTestMailTarget(server)
+	target.Sender = "App <app@example.com>"
+	target.Recipients = []string{"ops@example.com", "Dev Team <dev@example.com>"}
+	target.HTML = true
+	target.BatchWindow = 0
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Error("t1 <b>")
+	logger.Close()
+
+	mails := server.Mails(1)
+	if len(mails) != 1 {
+		t.Fatalf("got %d emails, expected 1", len(mails))
+	}
+	msg, err := mail.ReadMessage(strings.NewReader(mails[0]))
+	if err != nil {
+		t.Fatalf("mail.ReadMessage(): %v", err)
+	}
+	for header, expected := range map[string]string{
+		"From":         `"App" <app@example.com>`,
+		"To":           `<ops@example.com>, "Dev Team" <dev@example.com>`,
+		"Subject":      "Log",
+		"MIME-Version": "1.0",
+	} {
+		if value := msg.Header.Get(header); value != expected {
+			t.Errorf("%v = %q, expected %q", header, value, expected)
+		}
+	}
+	if _, err := msg.Header.Date(); err != nil {
+		t.Errorf("Date: %v", err)
+	}
+	if id := msg.Header.Get("Message-ID"); !strings.HasPrefix(id, "<") || !strings.HasSuffix(id, "@example.com>") {
+		t.Errorf("Message-ID = %q", id)
+	}
+
+	mediaType, params, _ := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, expected multipart/alternative", mediaType)
+	}
+	mr := multipart.NewReader(msg.Body, params["boundary"])
+	var parts []string
+	for {
+		part, err := mr.NextPart()
+		if err != nil {
+			break
+		}
+		body, _ := io.ReadAll(part) // decodes quoted-printable
+		parts = append(parts, part.Header.Get("Content-Type")+": "+string(body))
+	}
+	if len(parts) != 2 {
+		t.Fatalf("got %d parts, expected 2", len(parts))
+	}
+	if !strings.HasPrefix(parts[0], "text/plain; charset=UTF-8: ") || !strings.Contains(parts[0], "t1 <b>") {
+		t.Errorf("parts[0] = %q", parts[0])
+	}
+	if !strings.HasPrefix(parts[1], "text/html; charset=UTF-8: ") ||
+		!strings.Contains(parts[1], `<span class="mlog-error">`) || !strings.Contains(parts[1], "t1 &lt;b&gt;") {
+		t.Errorf("parts[1] = %q", parts[1])
+	}
+}
+
+func TestMailTargetRoutes(t *testing.T) {
+	server := &FakeSMTPServer{}
+	server.Start(t)
+	defer server.Close()
+
+	logger := log.NewLogger()
+	target := newTestMailTarget(server)
+	target.Subject = "{{.Level}} [{{.Category}}] on {{.Hostname}}: {{.FirstLine}}"
+	target.Routes = []log.MailRoute{
+		{&log.Filter{MaxLevel: LU.LevelPanic}, []string{"oncall@example.com"}},
+		{&log.Filter{MaxLevel: LU.LevelWarning, Categories: []string{"db.*"}},
+			[]string{"team@example.com"}},
+	}
+	target.BatchWindow = time.Hour
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	db := logger.GetLogger("db.sql")
+	db.Log(LU.LevelPanic, "t1\nmore")
+	db.Warning("t2")
+	db.Error("t3")
+	logger.Info("t4")
+	logger.GetLogger("web").Log(LU.LevelPanic, "t5")
+	logger.Close()
+
+	hostname, _ := os.Hostname()
+	expected := map[string]string{
+		"<oncall@example.com>, <team@example.com>": LU.LevelPanic.String() + " [db.sql] on " + hostname + ": t1",
+		"<team@example.com>":                       "Error [db.sql] on " + hostname + ": t3 (2 messages)",
+		"<ops@example.com>":                        "Info [] on " + hostname + ": t4",
+		"<oncall@example.com>":                     LU.LevelPanic.String() + " [web] on " + hostname + ": t5",
+	}
+	mails := server.Mails(len(expected))
+	if len(mails) != len(expected) {
+		t.Fatalf("got %d emails, expected %d", len(mails), len(expected))
+	}
+	for _, m := range mails {
+		msg, err := mail.ReadMessage(strings.NewReader(m))
+		if err != nil {
+			t.Fatalf("mail.ReadMessage(): %v", err)
+		}
+		to := msg.Header.Get("To")
+		subject, _ := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+		if subject != expected[to] {
+			t.Errorf("email to %v: Subject = %q, expected %q", to, subject, expected[to])
+		}
+		delete(expected, to)
+	}
+}
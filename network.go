@@ -5,11 +5,17 @@
 package log
 
 import (
+	"crypto/tls"
+	"encoding/binary"
 	"errors"
-	"fmt"
 	LU "github.com/fbaube/logutils"
 	"io"
 	"net"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
 )
 
 // NetworkTarget sends log messages over a network connection.
@@ -32,25 +38,121 @@ type NetworkTarget struct {
 	Persistent bool
 	// the size of the message channel.
 	BufferSize int
+	// the formatter to use instead of the Logger's, e.g. JSONFormatter.
+	// If nil, the message as formatted by the Logger is sent.
+	Formatter Formatter
+	// how messages are delimited, so that the receiver can split them.
+	// The default, FramingNewline, cannot tell apart a message that has
+	// newlines (e.g. one with a call stack) from several messages.
+	Framing Framing
+	// the delay before trying to reconnect after the peer has become
+	// unreachable. It doubles after every failed try, up to RetryMax.
+	RetryMin time.Duration
+	RetryMax time.Duration
+	// the file in which to spool messages while the peer is unreachable.
+	// They are sent, in order, once it is reachable again (also if that
+	// is in a later run). Empty means that such messages are dropped.
+	SpoolFile string
+	// maximum number of bytes allowed for the spool file; messages
+	// beyond it are dropped. Zero means no limit.
+	SpoolMaxBytes int64
+	// whether to connect with TLS, which the following fields configure.
+	// (It is implied by TLSConfig, CAFile and CertFile.)
+	TLS bool
+	// the PEM file of the CA certificates to verify the peer with. If it
+	// is empty, the system's CA certificates are used.
+	CAFile string
+	// the PEM files of the client certificate and its key, for peers
+	// that require mutual TLS.
+	CertFile string
+	KeyFile  string
+	// the host name to verify the peer's certificate against. If it is
+	// empty, the host of Address is used.
+	ServerName string
+	// the minimum TLS version, e.g. tls.VersionTLS13.
+	// Zero means TLS 1.2.
+	MinTLSVersion uint16
+	// the TLS configuration to use instead of the fields above.
+	TLSConfig *tls.Config
 
-	entries chan *Entry
-	conn    net.Conn
-	close   chan bool
+	entries   chan *Entry
+	format    func(*Entry) string // if set (e.g. by SyslogTarget), instead of Formatter
+	tlsConfig *tls.Config         // nil if not TLS
+	conn      net.Conn
+	close     chan bool
+	down      bool          // whether the peer is unreachable
+	backoff   time.Duration // the delay before the next reconnect
+	retry     *time.Timer
+	spool     *os.File
+	spoolSize int64 // the number of bytes in the spool file
+	dropped   atomic.Uint64
+	spooled   atomic.Uint64
+}
+
+// Framing is how NetworkTarget delimits the messages that it sends.
+type Framing int
+
+const (
+	// FramingNewline ends every message with a newline.
+	FramingNewline Framing = iota
+	// FramingLengthPrefixed puts the length of every message, as 4 bytes
+	// in big-endian order, before it.
+	FramingLengthPrefixed
+	// FramingOctetCounted puts the length of every message, in decimal,
+	// and a space before it, as in RFC 6587 ("LEN SP MSG").
+	FramingOctetCounted
+	// FramingNUL ends every message with a NUL byte.
+	FramingNUL
+	// FramingNone sends the messages as they are, for networks
+	// (e.g. "udp") where every message is a datagram of its own.
+	FramingNone
+)
+
+// frame delimits a message.
+func (f Framing) frame(msg string) string {
+	switch f {
+	case FramingLengthPrefixed:
+		var n [4]byte
+		binary.BigEndian.PutUint32(n[:], uint32(len(msg)))
+		return string(n[:]) + msg
+	case FramingOctetCounted:
+		return strconv.Itoa(len(msg)) + " " + msg
+	case FramingNUL:
+		return msg + "\x00"
+	case FramingNone:
+		return msg
+	}
+	return msg + "\n"
 }
 
 // NewNetworkTarget creates a NetworkTarget.
 // The new NetworkTarget takes these default options:
-// MaxLevel: LevelDbg, Persistent: true, BufferSize: 1024.
+// MaxLevel: LevelDbg, Persistent: true, BufferSize: 1024,
+// RetryMin: 1s, RetryMax: 1m.
 // You must specify the Network and Address fields.
 func NewNetworkTarget() *NetworkTarget {
 	return &NetworkTarget{
 		Filter:     &Filter{MaxLevel: LU.LevelDebug},
 		BufferSize: 1024,
 		Persistent: true,
+		RetryMin:   time.Second,
+		RetryMax:   time.Minute,
 		close:      make(chan bool, 0),
 	}
 }
 
+// Dropped returns the number of messages that were dropped
+// because the peer was unreachable and they could not be spooled.
+func (t *NetworkTarget) Dropped() uint64 {
+	return t.dropped.Load()
+}
+
+// Spooled returns the number of messages that were
+// spooled while the peer was unreachable.
+func (t *NetworkTarget) Spooled() uint64 {
+	return t.spooled.Load()
+}
+
 // Open prepares NetworkTarget for processing log messages.
 func (t *NetworkTarget) Open(errWriter io.Writer) error {
 	t.Filter.Init()
@@ -64,13 +166,39 @@ func (t *NetworkTarget) Open(errWriter io.Writer) error {
 	if t.Address == "" {
 		return errors.New("NetworkTarget.Address must be specified")
 	}
+	if t.RetryMin <= 0 {
+		return errors.New("NetworkTarget.RetryMin must be more than 0")
+	}
+	if t.RetryMax < t.RetryMin {
+		return errors.New("NetworkTarget.RetryMax must be no less than RetryMin")
+	}
+
+	tlsConfig, err := t.makeTLSConfig()
+	if err != nil {
+		return err
+	}
+	t.tlsConfig = tlsConfig
 
 	t.entries = make(chan *Entry, t.BufferSize)
 	t.conn = nil
+	t.down = false
+	t.retry = nil
+	t.spool = nil
+	if t.SpoolFile != "" {
+		if err := t.openSpool(); err != nil {
+			return err
+		}
+	}
 
-	if t.Persistent {
+	// If the peer is unreachable (or there are messages spooled
+	// from an earlier run), reconnecting is left to sendMessages.
+	if t.spoolSize > 0 {
+		t.down = true
+		t.backoff = t.RetryMin
+		t.retry = time.NewTimer(0)
+	} else if t.Persistent {
 		if err := t.connect(); err != nil {
-			return err
+			t.goDown(errWriter, err)
 		}
 	}
 
@@ -82,10 +210,9 @@ func (t *NetworkTarget) Open(errWriter io.Writer) error {
 // Process puts filtered log messages into a channel for sending over network.
 func (t *NetworkTarget) Process(e *Entry) {
 	if t.Allow(e) {
-		select {
-		case t.entries <- e:
-		default:
-		}
+		// If the channel is full, this waits, and the logger's
+		// Overflow policy decides what to do with what follows.
+		t.entries <- e
 	}
 }
 
@@ -94,9 +221,13 @@ func (t *NetworkTarget) Close() {
 	<-t.close
 }
 
-// Flush is a no-op.
+// Flush waits until the messages in the channel have been
+// sent (or spooled, or dropped, if the peer is unreachable).
 func (t *NetworkTarget) Flush() {
-	// <-t.close
+	var flushed sync.WaitGroup
+	flushed.Add(1)
+	t.entries <- &Entry{Time: time.Now(), op: opFlush, flushed: &flushed}
+	flushed.Wait()
 }
 
 func (t *NetworkTarget) DoesDetails() bool {
@@ -109,7 +240,13 @@ func (t *NetworkTarget) connect() error {
 		t.conn = nil
 	}
 
-	conn, err := net.Dial(t.Network, t.Address)
+	var conn net.Conn
+	var err error
+	if t.tlsConfig != nil {
+		conn, err = tls.Dial(t.Network, t.Address, t.tlsConfig)
+	} else {
+		conn, err = net.Dial(t.Network, t.Address)
+	}
 	if err != nil {
 		return err
 	}
@@ -124,18 +261,59 @@ func (t *NetworkTarget) connect() error {
 
 func (t *NetworkTarget) sendMessages(errWriter io.Writer) {
 	for {
-		entry := <-t.entries
-		if entry == nil {
-			if t.conn != nil {
-				t.conn.Close()
+		var retry <-chan time.Time
+		if t.retry != nil {
+			retry = t.retry.C
+		}
+		select {
+		case <-retry:
+			t.retry = nil
+			t.reconnect(errWriter)
+			continue
+		case entry := <-t.entries:
+			if entry == nil {
+				if t.retry != nil {
+					t.retry.Stop()
+				}
+				if t.conn != nil {
+					t.conn.Close()
+				}
+				if t.spool != nil {
+					t.spool.Close()
+				}
+				t.close <- true
+				return
+			}
+			if entry.op == opFlush {
+				entry.flushed.Done()
+				continue
 			}
-			t.close <- true
-			break
+			t.send(errWriter, t.message(entry))
 		}
-		if err := t.write(entry.String() + "\n"); err != nil {
-			fmt.Fprintf(errWriter, "NetworkTarget write error: %v\n", err)
+	}
+}
+
+// message formats and frames an entry, to be sent.
+func (t *NetworkTarget) message(e *Entry) string {
+	var msg string
+	if t.format != nil {
+		msg = t.format(e)
+	} else {
+		msg = e.Format(t.Formatter)
+	}
+	return t.Framing.frame(msg)
+}
+
+// send writes a message, or if the peer is unreachable, spools it.
+func (t *NetworkTarget) send(errWriter io.Writer, message string) {
+	if !t.down {
+		err := t.write(message)
+		if err == nil {
+			return
 		}
+		t.goDown(errWriter, err)
 	}
+	t.spoolMessage(errWriter, message)
 }
 
 func (t *NetworkTarget) write(message string) error {
@@ -0,0 +1,52 @@
+package log_test
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	log "github.com/fbaube/mlog"
+)
+
+func TestNetworkTargetFraming(t *testing.T) {
+	tests := []struct {
+		framing  log.Framing
+		expected string
+	}{
+		{log.FramingNewline, "t1\nt1\nt2\n"},
+		{log.FramingLengthPrefixed, "\x00\x00\x00\x05t1\nt1\x00\x00\x00\x02t2"},
+		{log.FramingOctetCounted, "5 t1\nt12 t2"},
+		{log.FramingNUL, "t1\nt1\x00t2\x00"},
+		{log.FramingNone, "t1\nt1t2"},
+	}
+	for _, test := range tests {
+		listener, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		server := &SpoolServer{}
+		server.Serve(listener)
+
+		logger := log.NewLogger()
+		target := log.NewNetworkTarget()
+		target.Network = "tcp"
+		target.Address = listener.Addr().String()
+		target.Framing = test.framing
+		target.Formatter = func(l *log.Logger, e *log.Entry) string {
+			return e.Message
+		}
+		logger.Targets = append(logger.Targets, target)
+		logger.Open()
+		logger.Info("t1\nt1")
+		logger.Info("t2")
+		logger.Close()
+
+		for i := 0; i < 100 && server.Received() != test.expected; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if result := server.Received(); result != test.expected {
+			t.Errorf("Framing %v: received %q, expected %q", test.framing, result, test.expected)
+		}
+		listener.Close()
+	}
+}
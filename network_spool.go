@@ -0,0 +1,154 @@
+package log
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	S "strings"
+	"time"
+)
+
+// goDown marks the peer as unreachable, reporting the error (if any),
+// and schedules a reconnect after the current backoff delay.
+func (t *NetworkTarget) goDown(errWriter io.Writer, err error) {
+	if err != nil {
+		fmt.Fprintf(errWriter, "NetworkTarget is unable to reach %v: %v\n", t.Address, err)
+	}
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	if !t.down {
+		t.down = true
+		t.backoff = t.RetryMin
+	}
+	t.retry = time.NewTimer(t.backoff)
+}
+
+// reconnect tries to reach the peer again, and if it can, sends
+// the spooled messages. Otherwise the backoff delay is doubled
+// (up to RetryMax) and another reconnect is scheduled.
+func (t *NetworkTarget) reconnect(errWriter io.Writer) {
+	if err := t.connect(); err != nil {
+		t.backoff *= 2
+		if t.backoff > t.RetryMax {
+			t.backoff = t.RetryMax
+		}
+		t.retry = time.NewTimer(t.backoff)
+		return
+	}
+	t.down = false
+	if err := t.replay(errWriter); err != nil {
+		t.goDown(errWriter, err)
+		return
+	}
+	if !t.Persistent {
+		t.conn.Close()
+		t.conn = nil
+	}
+}
+
+// openSpool opens (or creates) SpoolFile. Messages that
+// are in it from an earlier run are kept, to be sent.
+func (t *NetworkTarget) openSpool() error {
+	fd, err := os.OpenFile(t.SpoolFile, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0660)
+	if err != nil {
+		return fmt.Errorf("NetworkTarget was unable to create a spool file: %v", err)
+	}
+	fi, err := fd.Stat()
+	if err != nil {
+		fd.Close()
+		return fmt.Errorf("NetworkTarget was unable to create a spool file: %v", err)
+	}
+	t.spool = fd
+	t.spoolSize = fi.Size()
+	return nil
+}
+
+// spoolMessage appends a message to the spool file, as a record of its
+// length in bytes, a space, and the message. The message is dropped if
+// there is no spool file, or if it would grow beyond SpoolMaxBytes.
+func (t *NetworkTarget) spoolMessage(errWriter io.Writer, message string) {
+	if t.spool == nil {
+		t.dropped.Add(1)
+		return
+	}
+	record := fmt.Sprintf("%d %s", len(message), message)
+	if t.SpoolMaxBytes > 0 && t.spoolSize+int64(len(record)) > t.SpoolMaxBytes {
+		t.dropped.Add(1)
+		return
+	}
+	n, err := t.spool.WriteString(record)
+	t.spoolSize += int64(n)
+	if err != nil {
+		fmt.Fprintf(errWriter, "NetworkTarget spool error: %v\n", err)
+		t.dropped.Add(1)
+		return
+	}
+	t.spooled.Add(1)
+}
+
+// replay sends the spooled messages in order over the connection, and
+// then empties the spool file. If sending fails, the messages that were
+// not sent are kept in the spool file for the next reconnect.
+func (t *NetworkTarget) replay(errWriter io.Writer) error {
+	if t.spool == nil || t.spoolSize == 0 {
+		return nil
+	}
+	if _, err := t.spool.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	r := bufio.NewReader(t.spool)
+	var sent int64 // the bytes of the records that were sent
+	for {
+		prefix, err := r.ReadString(' ')
+		if err == io.EOF && prefix == "" {
+			break
+		}
+		n, cerr := strconv.Atoi(S.TrimSuffix(prefix, " "))
+		if err != nil || cerr != nil || n < 0 {
+			// e.g. a record that was cut short by a crash
+			fmt.Fprintf(errWriter, "NetworkTarget spool file is corrupt at byte %v\n", sent)
+			break
+		}
+		message := make([]byte, n)
+		if _, err := io.ReadFull(r, message); err != nil {
+			fmt.Fprintf(errWriter, "NetworkTarget spool file is corrupt at byte %v\n", sent)
+			break
+		}
+		if _, err := t.conn.Write(message); err != nil {
+			t.keepSpooled(errWriter, sent)
+			return err
+		}
+		sent += int64(len(prefix) + n)
+	}
+	if err := t.spool.Truncate(0); err != nil {
+		fmt.Fprintf(errWriter, "NetworkTarget spool error: %v\n", err)
+	}
+	t.spoolSize = 0
+	return nil
+}
+
+// keepSpooled removes the first sent bytes (i.e. the records that
+// were sent) from the spool file, keeping the rest of it.
+func (t *NetworkTarget) keepSpooled(errWriter io.Writer, sent int64) {
+	if sent == 0 {
+		return
+	}
+	rest := make([]byte, t.spoolSize-sent)
+	if _, err := t.spool.ReadAt(rest, sent); err != nil {
+		fmt.Fprintf(errWriter, "NetworkTarget spool error: %v\n", err)
+		return
+	}
+	if err := t.spool.Truncate(0); err != nil {
+		fmt.Fprintf(errWriter, "NetworkTarget spool error: %v\n", err)
+		return
+	}
+	n, err := t.spool.Write(rest)
+	t.spoolSize = int64(n)
+	if err != nil {
+		fmt.Fprintf(errWriter, "NetworkTarget spool error: %v\n", err)
+	}
+}
@@ -0,0 +1,167 @@
+package log_test
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/fbaube/mlog"
+)
+
+// SpoolServer collects everything that is sent to it.
+type SpoolServer struct {
+	listener net.Listener
+	mu       sync.Mutex
+	received []byte
+}
+
+func (s *SpoolServer) Start(address string) error {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	s.Serve(listener)
+	return nil
+}
+
+// Serve collects what is sent to the listener, in the background.
+func (s *SpoolServer) Serve(listener net.Listener) {
+	s.listener = listener
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				for {
+					n, err := conn.Read(buf)
+					s.mu.Lock()
+					s.received = append(s.received, buf[:n]...)
+					s.mu.Unlock()
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+}
+
+func (s *SpoolServer) Received() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return string(s.received)
+}
+
+// freeAddress returns a local address that nothing listens on.
+func freeAddress(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func newSpoolingLogger(address, spoolFile string) (*log.Logger, *log.NetworkTarget) {
+	logger := log.NewLogger()
+	logger.ErrorWriter = io.Discard
+	target := log.NewNetworkTarget()
+	target.Network = "tcp"
+	target.Address = address
+	target.RetryMin = 10 * time.Millisecond
+	target.RetryMax = 40 * time.Millisecond
+	target.SpoolFile = spoolFile
+	target.Formatter = func(l *log.Logger, e *log.Entry) string {
+		return e.Message
+	}
+	logger.Targets = append(logger.Targets, target)
+	return logger, target
+}
+
+func TestNetworkTargetSpool(t *testing.T) {
+	address := freeAddress(t)
+	spoolFile := filepath.Join(t.TempDir(), "app.spool")
+
+	// The peer is unreachable, so the messages are spooled.
+	logger, target := newSpoolingLogger(address, spoolFile)
+	if err := logger.Open(); err != nil {
+		t.Fatalf("logger.Open(): %v", err)
+	}
+	logger.Info("t1")
+	logger.Info("t2\nt2")
+	logger.Info("t3")
+	logger.Close()
+	if target.Spooled() != 3 {
+		t.Errorf("target.Spooled() = %v, expected %v", target.Spooled(), 3)
+	}
+	if target.Dropped() != 0 {
+		t.Errorf("target.Dropped() = %v, expected %v", target.Dropped(), 0)
+	}
+	if fi, err := os.Stat(spoolFile); err != nil || fi.Size() == 0 {
+		t.Fatalf("spool file is empty or missing: %v", err)
+	}
+
+	// Once the peer is reachable, they are sent first, in order.
+	server := &SpoolServer{}
+	if err := server.Start(address); err != nil {
+		t.Fatalf("server.Start(): %v", err)
+	}
+	defer server.listener.Close()
+	logger, _ = newSpoolingLogger(address, spoolFile)
+	if err := logger.Open(); err != nil {
+		t.Fatalf("logger.Open(): %v", err)
+	}
+	for i := 0; i < 100 && !strings.Contains(server.Received(), "t3"); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	logger.Info("t4")
+	logger.Close()
+
+	expected := "t1\nt2\nt2\nt3\nt4\n"
+	for i := 0; i < 100 && server.Received() != expected; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if result := server.Received(); result != expected {
+		t.Errorf("received %q, expected %q", result, expected)
+	}
+	if fi, err := os.Stat(spoolFile); err != nil || fi.Size() != 0 {
+		t.Errorf("spool file was not emptied: %v", err)
+	}
+}
+
+func TestNetworkTargetDropped(t *testing.T) {
+	logger, target := newSpoolingLogger(freeAddress(t), "")
+	logger.Open()
+	logger.Info("t1")
+	logger.Info("t2")
+	logger.Close()
+	if target.Dropped() != 2 {
+		t.Errorf("target.Dropped() = %v, expected %v", target.Dropped(), 2)
+	}
+	if target.Spooled() != 0 {
+		t.Errorf("target.Spooled() = %v, expected %v", target.Spooled(), 0)
+	}
+}
+
+func TestNetworkTargetFlush(t *testing.T) {
+	spoolFile := filepath.Join(t.TempDir(), "app.spool")
+	logger, target := newSpoolingLogger(freeAddress(t), spoolFile)
+	logger.Open()
+	defer logger.Close()
+	for i := 0; i < 10; i++ {
+		logger.Info("t%d", i)
+	}
+	logger.Flush()
+	if target.Spooled() != 10 {
+		t.Errorf("target.Spooled() = %v after Flush(), expected %v", target.Spooled(), 10)
+	}
+}
@@ -0,0 +1,52 @@
+package log
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// makeTLSConfig makes the TLS configuration from the TLS fields
+// of NetworkTarget, or returns nil if TLS is not to be used.
+func (t *NetworkTarget) makeTLSConfig() (*tls.Config, error) {
+	if t.TLSConfig != nil {
+		return t.TLSConfig, nil
+	}
+	if !t.TLS && t.CAFile == "" && t.CertFile == "" {
+		return nil, nil
+	}
+	switch t.Network {
+	case "udp", "udp4", "udp6", "ip", "ip4", "ip6", "unixgram":
+		return nil, fmt.Errorf("NetworkTarget cannot use TLS over %v", t.Network)
+	}
+	if (t.CertFile == "") != (t.KeyFile == "") {
+		return nil, errors.New("NetworkTarget.CertFile and NetworkTarget.KeyFile must be specified together")
+	}
+	config := &tls.Config{
+		ServerName: t.ServerName,
+		MinVersion: t.MinTLSVersion,
+	}
+	if config.MinVersion == 0 {
+		config.MinVersion = tls.VersionTLS12
+	}
+	if t.CAFile != "" {
+		pem, err := os.ReadFile(t.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("NetworkTarget was unable to read the CA file: %v", err)
+		}
+		config.RootCAs = x509.NewCertPool()
+		if !config.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("NetworkTarget found no certificates in the CA file %v", t.CAFile)
+		}
+	}
+	if t.CertFile != "" {
+		cert, err := tls.LoadX509KeyPair(t.CertFile, t.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("NetworkTarget was unable to load the client certificate: %v", err)
+		}
+		config.Certificates = []tls.Certificate{cert}
+	}
+	return config, nil
+}
@@ -0,0 +1,162 @@
+package log_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/fbaube/mlog"
+)
+
+// testCert is a certificate and its key, in PEM files.
+type testCert struct {
+	cert     *x509.Certificate
+	key      *ecdsa.PrivateKey
+	certFile string
+	keyFile  string
+}
+
+// newTestCert makes a certificate that is signed by the parent
+// (or self-signed if the parent is nil), and saves it in dir.
+func newTestCert(t *testing.T, dir, name string, parent *testCert) *testCert {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	signer, signerKey := template, key
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+	} else {
+		signer, signerKey = parent.cert, parent.key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, signer, &key.PublicKey, signerKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ := x509.ParseCertificate(der)
+	keyDer, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &testCert{
+		cert:     cert,
+		key:      key,
+		certFile: filepath.Join(dir, name+".crt"),
+		keyFile:  filepath.Join(dir, name+".key"),
+	}
+	os.WriteFile(c.certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600)
+	os.WriteFile(c.keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDer}), 0600)
+	return c
+}
+
+func TestNetworkTargetTLS(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+	server := newTestCert(t, dir, "server", ca)
+	client := newTestCert(t, dir, "client", ca)
+
+	pair, err := tls.LoadX509KeyPair(server.certFile, server.keyFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(ca.cert)
+	// The server requires mutual TLS.
+	serverConfig := &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+	}
+
+	for _, persistent := range []bool{true, false} {
+		listener, err := tls.Listen("tcp", "127.0.0.1:0", serverConfig)
+		if err != nil {
+			t.Fatal(err)
+		}
+		logServer := &SpoolServer{}
+		logServer.Serve(listener)
+
+		logger := log.NewLogger()
+		target := log.NewNetworkTarget()
+		target.Network = "tcp"
+		target.Address = listener.Addr().String()
+		target.Persistent = persistent
+		target.CAFile = ca.certFile
+		target.CertFile = client.certFile
+		target.KeyFile = client.keyFile
+		target.MinTLSVersion = tls.VersionTLS13
+		target.Formatter = func(l *log.Logger, e *log.Entry) string {
+			return e.Message
+		}
+		errWriter := &MemoryWriter{}
+		logger.ErrorWriter = errWriter
+		logger.Targets = append(logger.Targets, target)
+		if err := logger.Open(); err != nil {
+			t.Fatalf("logger.Open(): %v", err)
+		}
+		logger.Info("t1")
+		logger.Info("t2")
+		logger.Close()
+
+		expected := "t1\nt2\n"
+		for i := 0; i < 100 && logServer.Received() != expected; i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+		if result := logServer.Received(); result != expected {
+			t.Errorf("Persistent %v: received %q, expected %q (errors: %q)",
+				persistent, result, expected, errWriter.bytes)
+		}
+		listener.Close()
+	}
+}
+
+func TestNetworkTargetTLSConfig(t *testing.T) {
+	dir := t.TempDir()
+	ca := newTestCert(t, dir, "ca", nil)
+
+	target := log.NewNetworkTarget()
+	target.Network = "tcp"
+	target.Address = "127.0.0.1:1"
+	target.CertFile = ca.certFile
+	if err := target.Open(&MemoryWriter{}); err == nil ||
+		!strings.Contains(err.Error(), "KeyFile") {
+		t.Errorf("Open() with no KeyFile: %v", err)
+	}
+
+	target = log.NewNetworkTarget()
+	target.Network = "tcp"
+	target.Address = "127.0.0.1:1"
+	target.CAFile = filepath.Join(dir, "missing.crt")
+	if err := target.Open(&MemoryWriter{}); err == nil {
+		t.Errorf("Open() with a missing CAFile should fail")
+	}
+
+	target = log.NewNetworkTarget()
+	target.Network = "udp"
+	target.Address = "127.0.0.1:1"
+	target.TLS = true
+	if err := target.Open(&MemoryWriter{}); err == nil {
+		t.Errorf("Open() with TLS over UDP should fail")
+	}
+}
@@ -0,0 +1,125 @@
+package log
+
+import (
+	"sync"
+	"time"
+)
+
+// OverflowPolicy is what a Logger does with a message
+// when the queue of one of its targets is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the message.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest message in the queue.
+	OverflowDropOldest
+	// OverflowBlockTimeout waits until there is room in the queue,
+	// but for at most OverflowTimeout, and then drops the message.
+	OverflowBlockTimeout
+)
+
+// entryQueue is the queue of entries for one target, which a worker
+// goroutine hands to it. Only log messages are dropped on overflow;
+// other operations (and the nil that signals the close of the logger)
+// are always queued, if need be beyond its size. Entries are pushed
+// in the order of their tickets, so that every queue of a logger has
+// them in the same order, without a lock held while a push waits.
+type entryQueue struct {
+	mu      sync.Mutex
+	cond    *sync.Cond // signaled when an entry is pushed or popped
+	entries []*Entry
+	size    int
+	dropped uint64
+	next    uint64 // the ticket of the entry to be pushed next
+}
+
+func newEntryQueue(size int) *entryQueue {
+	if size < 1 {
+		size = 1
+	}
+	q := &entryQueue{size: size}
+	q.cond = sync.NewCond(&q.mu)
+	return q
+}
+
+// droppable returns whether an entry is a log message,
+// which an OverflowPolicy can drop.
+func droppable(e *Entry) bool {
+	return e != nil && (e.op == opLog || e.op == opQuote)
+}
+
+// push queues an entry, once the entries of the tickets before
+// its own have been pushed (or dropped), and if the queue is full,
+// does as the policy says. It returns false if it was dropped.
+func (q *entryQueue) push(e *Entry, ticket uint64, policy OverflowPolicy, timeout time.Duration) bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for q.next != ticket {
+		q.cond.Wait()
+	}
+	defer func() {
+		q.next++
+		q.cond.Broadcast()
+	}()
+	if len(q.entries) >= q.size {
+		switch {
+		case !droppable(e):
+		case policy == OverflowDropNewest:
+			q.dropped++
+			return false
+		case policy == OverflowDropOldest:
+			for i, old := range q.entries {
+				if droppable(old) {
+					q.entries = append(q.entries[:i], q.entries[i+1:]...)
+					q.dropped++
+					break
+				}
+			}
+		case policy == OverflowBlockTimeout:
+			deadline := time.Now().Add(timeout)
+			timer := time.AfterFunc(timeout, func() {
+				q.mu.Lock()
+				q.cond.Broadcast()
+				q.mu.Unlock()
+			})
+			for len(q.entries) >= q.size && time.Now().Before(deadline) {
+				q.cond.Wait()
+			}
+			timer.Stop()
+			if len(q.entries) >= q.size {
+				q.dropped++
+				return false
+			}
+		default:
+			for len(q.entries) >= q.size {
+				q.cond.Wait()
+			}
+		}
+	}
+	q.entries = append(q.entries, e)
+	return true
+}
+
+// pop waits for an entry, and removes it from the queue.
+func (q *entryQueue) pop() *Entry {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for len(q.entries) == 0 {
+		q.cond.Wait()
+	}
+	e := q.entries[0]
+	q.entries[0] = nil
+	q.entries = q.entries[1:]
+	q.cond.Broadcast()
+	return e
+}
+
+// droppedCount returns the number of entries dropped so far.
+func (q *entryQueue) droppedCount() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.dropped
+}
@@ -0,0 +1,215 @@
+package log_test
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	log "github.com/fbaube/mlog"
+)
+
+// SlowTarget records the messages, and if release is set,
+// waits on it before it returns from Process.
+type SlowTarget struct {
+	entered  chan bool // gets a value when Process starts waiting
+	release  chan bool
+	close    chan bool
+	mu       sync.Mutex
+	messages []string
+}
+
+func NewSlowTarget(slow bool) *SlowTarget {
+	t := &SlowTarget{close: make(chan bool)}
+	if slow {
+		t.entered = make(chan bool, 100)
+		t.release = make(chan bool)
+	}
+	return t
+}
+
+func (t *SlowTarget) Open(io.Writer) error {
+	return nil
+}
+
+func (t *SlowTarget) Process(e *log.Entry) {
+	if e == nil {
+		t.close <- true
+		return
+	}
+	t.mu.Lock()
+	t.messages = append(t.messages, e.Message)
+	t.mu.Unlock()
+	if t.release != nil {
+		t.entered <- true
+		<-t.release
+	}
+}
+
+func (t *SlowTarget) Messages() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return strings.Join(t.messages, ",")
+}
+
+func (t *SlowTarget) Close() {
+	<-t.close
+}
+
+func (t *SlowTarget) Flush() {
+	t.mu.Lock()
+	t.messages = append(t.messages, "flush")
+	t.mu.Unlock()
+}
+
+func (t *SlowTarget) DoesDetails() bool {
+	return false
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	tests := []struct {
+		policy   log.OverflowPolicy
+		expected string
+		dropped  uint64
+	}{
+		{log.OverflowDropNewest, "t1,t2,t3", 2},
+		{log.OverflowDropOldest, "t1,t4,t5", 2},
+		{log.OverflowBlockTimeout, "t1,t2,t3", 2},
+		{log.OverflowBlock, "t1,t2,t3,t4,t5", 0},
+	}
+	for _, test := range tests {
+		logger := log.NewLogger()
+		logger.BufferSize = 2
+		logger.Overflow = test.policy
+		logger.OverflowTimeout = 10 * time.Millisecond
+		slow, fast := NewSlowTarget(true), NewSlowTarget(false)
+		logger.Targets = append(logger.Targets, slow, fast)
+		logger.Open()
+
+		logger.Info("t1")
+		<-slow.entered // t1 is being processed; the queue is empty
+		done := make(chan bool)
+		go func() {
+			for i := 2; i <= 5; i++ {
+				logger.Info(fmt.Sprintf("t%d", i))
+				// The fast target is not stalled by the slow one.
+				for j := 0; j < 100 && !strings.HasSuffix(fast.Messages(), fmt.Sprintf("t%d", i)); j++ {
+					time.Sleep(time.Millisecond)
+				}
+			}
+			done <- true
+		}()
+		if test.policy == log.OverflowBlock {
+			select {
+			case <-done:
+				t.Errorf("policy %v: Log did not block", test.policy)
+			case <-time.After(50 * time.Millisecond):
+			}
+			close(slow.release)
+			<-done
+		} else {
+			<-done
+			if result := fast.Messages(); result != "t1,t2,t3,t4,t5" {
+				t.Errorf("policy %v: fast target got %q", test.policy, result)
+			}
+			close(slow.release)
+		}
+		logger.Close()
+
+		if result := slow.Messages(); result != test.expected {
+			t.Errorf("policy %v: slow target got %q, expected %q", test.policy, result, test.expected)
+		}
+		if n := logger.DroppedFor(slow); n != test.dropped {
+			t.Errorf("policy %v: DroppedFor(slow) = %v, expected %v", test.policy, n, test.dropped)
+		}
+		if n := logger.DroppedFor(fast); n != 0 {
+			t.Errorf("policy %v: DroppedFor(fast) = %v, expected 0", test.policy, n)
+		}
+		if n := logger.Dropped(); n != test.dropped {
+			t.Errorf("policy %v: Dropped() = %v, expected %v", test.policy, n, test.dropped)
+		}
+	}
+}
+
+func TestLoggerFlush(t *testing.T) {
+	logger := log.NewLogger()
+	slow := NewSlowTarget(true)
+	logger.Targets = append(logger.Targets, slow)
+	logger.Open()
+	logger.Info("t1")
+	<-slow.entered
+	logger.Info("t2")
+
+	flushed := make(chan bool)
+	go func() {
+		logger.Flush()
+		flushed <- true
+	}()
+	select {
+	case <-flushed:
+		t.Errorf("Flush() returned before the messages were processed")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(slow.release)
+	<-flushed
+	if result := slow.Messages(); result != "t1,t2,flush" {
+		t.Errorf("slow target got %q, expected %q", result, "t1,t2,flush")
+	}
+	logger.Close()
+}
+
+func TestLoggerSynchronous(t *testing.T) {
+	logger := log.NewLogger()
+	logger.Synchronous = true
+	writer := &MemoryWriter{}
+	console := log.NewConsoleTarget()
+	console.Writer = writer
+	console.ColorMode = false
+	target := NewSlowTarget(false)
+	logger.Targets = append(logger.Targets, console, target)
+	logger = logger.GetLogger("", func(l *log.Logger, e *log.Entry) string {
+		return e.Message
+	})
+	logger.Open()
+
+	logger.Info("t1")
+	fmt.Fprintln(writer, "x")
+	logger.Info("t2")
+	logger.Flush()
+	if result := target.Messages(); result != "t1,t2,flush" {
+		t.Errorf("target got %q, expected %q", result, "t1,t2,flush")
+	}
+	logger.Close()
+
+	if result := string(writer.bytes); result != "t1\nx\nt2\n" {
+		t.Errorf("console output = %q, expected %q", result, "t1\nx\nt2\n")
+	}
+}
+
+func TestDroppedWithStuckTarget(t *testing.T) {
+	logger := log.NewLogger()
+	logger.BufferSize = 1
+	slow := NewSlowTarget(true)
+	logger.Targets = append(logger.Targets, slow)
+	logger.Open()
+	logger.Info("t1")
+	<-slow.entered // t1 is being processed
+	logger.Info("t2")
+	go logger.Info("t3") // waits for room in the full queue
+
+	done := make(chan bool)
+	go func() {
+		logger.Dropped()
+		logger.DroppedFor(slow)
+		done <- true
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Errorf("Dropped() waited for the stuck target")
+	}
+	close(slow.release)
+	logger.Close()
+}
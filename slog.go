@@ -0,0 +1,143 @@
+package log
+
+import (
+	"context"
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	"log/slog"
+	"runtime"
+	S "strings"
+	"time"
+)
+
+// These slog levels fill the gaps in the slog.Level set, so that slog
+// callers can log at every LU.Level. Okay sits between Info and Warn
+// (like RFC5424 "Notice"), and Panic sits above Error.
+const (
+	SlogLevelOkay  slog.Level = slog.LevelInfo + 2
+	SlogLevelPanic slog.Level = slog.LevelError + 4
+)
+
+// LevelOfSlog maps a slog.Level to the LU.Level set:
+// Panic, Error, Warning, Okay, Info, Debug.
+func LevelOfSlog(lvl slog.Level) LU.Level {
+	switch {
+	case lvl >= SlogLevelPanic:
+		return LU.LevelPanic
+	case lvl >= slog.LevelError:
+		return LU.LevelError
+	case lvl >= slog.LevelWarn:
+		return LU.LevelWarning
+	case lvl >= SlogLevelOkay:
+		return LU.LevelOkay
+	case lvl >= slog.LevelInfo:
+		return LU.LevelInfo
+	}
+	return LU.LevelDebug
+}
+
+// SlogHandler is a slog.Handler that turns each slog.Record into an
+// Entry of its Logger, so that code using the log/slog API logs thru
+// the same coreLogger (and the same Targets) as everything else.
+// Attrs become Entry.Fields; group names become key prefixes, as in
+// "req.method".
+type SlogHandler struct {
+	logger *Logger
+	fields []Field // from WithAttrs, already prefixed
+	prefix string  // from WithGroup, e.g. "req." or "req.hdr."
+}
+
+// NewSlogHandler creates a SlogHandler that logs thru the Logger,
+// using its category, formatter and fields.
+func NewSlogHandler(l *Logger) *SlogHandler {
+	return &SlogHandler{logger: l}
+}
+
+// Slog returns a *slog.Logger that logs thru this Logger.
+func (l *Logger) Slog() *slog.Logger {
+	return slog.New(NewSlogHandler(l))
+}
+
+// Enabled reports whether the Logger is open and
+// would log a message at the (mapped) level.
+func (h *SlogHandler) Enabled(_ context.Context, lvl slog.Level) bool {
+	return h.logger.enabled(LevelOfSlog(lvl))
+}
+
+// Handle converts the Record to an Entry and dispatches it.
+// If CallStackDepth is set, the call stack is the single
+// frame of the Record's PC, since slog records no more.
+func (h *SlogHandler) Handle(_ context.Context, r slog.Record) error {
+	l := h.logger
+	level := LevelOfSlog(r.Level)
+	if !l.enabled(level) {
+		return nil
+	}
+	fields := make([]Field, len(l.Fields), len(l.Fields)+len(h.fields)+r.NumAttrs())
+	copy(fields, l.Fields)
+	fields = append(fields, h.fields...)
+	r.Attrs(func(a slog.Attr) bool {
+		fields = appendAttr(fields, h.prefix, a)
+		return true
+	})
+	entry := &Entry{
+		Category: l.Category,
+		Level:    level,
+		Message:  r.Message,
+		Fields:   fields,
+		Time:     r.Time,
+	}
+	if entry.Time.IsZero() {
+		entry.Time = time.Now()
+	}
+	if l.CallStackDepth > 0 && r.PC != 0 {
+		frame, _ := runtime.CallersFrames([]uintptr{r.PC}).Next()
+		if l.CallStackFilter == "" || S.Contains(frame.File, l.CallStackFilter) {
+			entry.CallStack = fmt.Sprintf("\n%s:%d", frame.File, frame.Line)
+		}
+	}
+	l.dispatch(entry)
+	return nil
+}
+
+// WithAttrs returns a handler whose Entry's also carry the attrs.
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	h2 := *h
+	h2.fields = make([]Field, len(h.fields), len(h.fields)+len(attrs))
+	copy(h2.fields, h.fields)
+	for _, a := range attrs {
+		h2.fields = appendAttr(h2.fields, h.prefix, a)
+	}
+	return &h2
+}
+
+// WithGroup returns a handler that prefixes the keys
+// of all later attrs with the group name and a ".".
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	h2 := *h
+	h2.prefix = h.prefix + name + "."
+	return &h2
+}
+
+// appendAttr appends an attr as a Field, resolving LogValuers and
+// flattening groups. Empty attrs are ignored, as slog requires, and
+// a group with an empty key is inlined.
+func appendAttr(fields []Field, prefix string, a slog.Attr) []Field {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return fields
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		if a.Key != "" {
+			prefix += a.Key + "."
+		}
+		for _, ga := range a.Value.Group() {
+			fields = appendAttr(fields, prefix, ga)
+		}
+		return fields
+	}
+	return append(fields, Field{prefix + a.Key, a.Value.Any()})
+}
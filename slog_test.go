@@ -0,0 +1,58 @@
+package log_test
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func TestLevelOfSlog(t *testing.T) {
+	tests := []struct {
+		in       slog.Level
+		expected LU.Level
+	}{
+		{slog.LevelDebug, LU.LevelDebug},
+		{slog.LevelInfo, LU.LevelInfo},
+		{log.SlogLevelOkay, LU.LevelOkay},
+		{slog.LevelWarn, LU.LevelWarning},
+		{slog.LevelError, LU.LevelError},
+		{log.SlogLevelPanic, LU.LevelPanic},
+	}
+	for _, test := range tests {
+		if lvl := log.LevelOfSlog(test.in); lvl != test.expected {
+			t.Errorf("LevelOfSlog(%v) = %v, expected %v", test.in, lvl, test.expected)
+		}
+	}
+}
+
+func TestSlogHandler(t *testing.T) {
+	logger := log.NewLogger()
+	target := &ConsoleTargetMock{
+		done:          make(chan bool, 0),
+		ConsoleTarget: log.NewConsoleTarget(),
+	}
+	writer := &MemoryWriter{}
+	target.Writer = writer
+	target.ColorMode = false
+	target.MaxLevel = LU.LevelWarning
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+
+	sl := logger.Slog().With("a", 1).WithGroup("g")
+	sl.Info("t1")
+	sl.Warn("t2", "k", "v", slog.Group("h", "x", 2))
+
+	logger.Close()
+	<-target.done
+
+	result := string(writer.bytes)
+	if strings.Contains(result, "t1") {
+		t.Errorf("Found unexpected %q", "t1")
+	}
+	if !strings.Contains(result, "t2 a=1 g.k=v g.h.x=2") {
+		t.Errorf("Expected %q not found in %q", "t2 a=1 g.k=v g.h.x=2", result)
+	}
+}
@@ -0,0 +1,197 @@
+package log
+
+import (
+	"errors"
+	"fmt"
+	LU "github.com/fbaube/logutils"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	S "strings"
+)
+
+// SyslogSDID is the ID of the structured data element
+// in which SyslogTarget sends the fields of a message.
+const SyslogSDID = "mlog@32473"
+
+// SyslogSockets are the paths where SyslogTarget
+// looks for the local syslog daemon's socket.
+var SyslogSockets = []string{"/dev/log", "/var/run/syslog", "/var/run/log"}
+
+// SyslogTarget sends log messages to a syslog server, framed per
+// RFC 5424 (or the older RFC 3164). Its severity is that of the
+// level, as in the table in the README (but LevelDbg is "debug"
+// too); its MSGID is the category; and the fields are sent as
+// structured data, in an element with the ID SyslogSDID.
+//
+// It is a NetworkTarget, so it reconnects and spools the same
+// way. If Network is "udp" (or "unixgram"), every message is a
+// datagram; if it is "tcp" (with TLS as in RFC 5425, if wanted),
+// messages are octet-counted per RFC 6587. (Open sets Framing
+// thus.) If Network is empty, the local syslog daemon's socket
+// is used.
+type SyslogTarget struct {
+	*NetworkTarget
+	// whether to use the BSD syslog format of RFC 3164 (which
+	// has no MSGID or structured data) rather than RFC 5424.
+	RFC3164 bool
+	// the facility, e.g. 1 (user-level) or 16-23 (local0-local7).
+	Facility int
+	// the HOSTNAME. If it is empty, os.Hostname() is used.
+	Hostname string
+	// the APP-NAME (in RFC 3164, the TAG). If it is
+	// empty, the base name of the executable is used.
+	AppName string
+	// the PROCID. If it is empty, the process ID is used.
+	ProcID string
+
+	hostname string
+	appName  string
+	procID   string
+}
+
+// NewSyslogTarget creates a SyslogTarget.
+// The new SyslogTarget takes these default options:
+// MaxLevel: LevelDbg, Persistent: true, BufferSize: 1024,
+// Facility: 1 (user-level). If Network and Address are
+// not set, the local syslog daemon is used.
+func NewSyslogTarget() *SyslogTarget {
+	return &SyslogTarget{
+		NetworkTarget: NewNetworkTarget(),
+		Facility:      1,
+	}
+}
+
+// Open prepares SyslogTarget for processing log messages.
+func (t *SyslogTarget) Open(errWriter io.Writer) error {
+	if t.Facility < 0 || t.Facility > 23 {
+		return errors.New("SyslogTarget.Facility must be between 0 and 23")
+	}
+	if t.Network == "" {
+		network, address, err := localSyslog()
+		if err != nil {
+			return err
+		}
+		t.Network, t.Address = network, address
+	}
+	t.hostname = t.Hostname
+	if t.hostname == "" {
+		t.hostname, _ = os.Hostname()
+	}
+	t.appName = t.AppName
+	if t.appName == "" {
+		t.appName = filepath.Base(os.Args[0])
+	}
+	t.procID = t.ProcID
+	if t.procID == "" {
+		t.procID = strconv.Itoa(os.Getpid())
+	}
+
+	t.format = t.formatMessage
+	switch t.Network {
+	case "udp", "udp4", "udp6", "unixgram":
+		t.Framing = FramingNone
+	case "unix":
+		t.Framing = FramingNewline
+	default:
+		t.Framing = FramingOctetCounted
+	}
+	return t.NetworkTarget.Open(errWriter)
+}
+
+// localSyslog finds the local syslog daemon's socket.
+func localSyslog() (network, address string, err error) {
+	for _, path := range SyslogSockets {
+		for _, network := range []string{"unixgram", "unix"} {
+			conn, err := net.Dial(network, path)
+			if err == nil {
+				conn.Close()
+				return network, path, nil
+			}
+		}
+	}
+	return "", "", errors.New("SyslogTarget found no local syslog daemon")
+}
+
+// SyslogSeverity returns the syslog severity of a level.
+func SyslogSeverity(level LU.Level) int {
+	switch {
+	case level < 0:
+		return 0
+	case level > 7:
+		return 7
+	}
+	return int(level)
+}
+
+// formatMessage formats an entry as a syslog message (without framing).
+func (t *SyslogTarget) formatMessage(e *Entry) string {
+	pri := t.Facility*8 + SyslogSeverity(e.Level)
+	msg := e.Message
+	if t.Formatter != nil {
+		msg = e.Format(t.Formatter)
+	} else if e.CallStack != "" {
+		msg += e.CallStack // which starts with "\n"
+	}
+	if t.RFC3164 {
+		return fmt.Sprintf("<%d>%s %s %s[%s]: %s", pri,
+			e.Time.Format("Jan _2 15:04:05"), syslogName(t.hostname, 255),
+			syslogName(t.appName, 32), syslogName(t.procID, 128), msg)
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %s %s %s %s", pri,
+		e.Time.Format("2006-01-02T15:04:05.000000Z07:00"),
+		syslogName(t.hostname, 255), syslogName(t.appName, 48),
+		syslogName(t.procID, 128), syslogName(e.Category, 32),
+		syslogData(e.Fields), msg)
+}
+
+// syslogName makes a header field of at most max printable
+// ASCII characters (but no spaces), or "-" if it is empty.
+func syslogName(s string, max int) string {
+	s = S.Map(func(r rune) rune {
+		if r < 33 || r > 126 {
+			return '_'
+		}
+		return r
+	}, s)
+	if len(s) > max {
+		s = s[:max]
+	}
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// syslogData makes the structured data element of the fields,
+// or "-" if there are none.
+func syslogData(fields []Field) string {
+	if len(fields) == 0 {
+		return "-"
+	}
+	var sb S.Builder
+	sb.WriteString("[" + SyslogSDID)
+	for _, f := range fields {
+		name := S.Map(func(r rune) rune {
+			if r < 33 || r > 126 || r == '=' || r == ']' || r == '"' {
+				return '_'
+			}
+			return r
+		}, f.Key)
+		if len(name) > 32 {
+			name = name[:32]
+		} else if name == "" {
+			name = badKey
+		}
+		value := fmt.Sprint(f.Value)
+		if err, ok := f.Value.(error); ok {
+			value = err.Error()
+		}
+		value = S.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`).Replace(value)
+		sb.WriteString(" " + name + `="` + value + `"`)
+	}
+	sb.WriteString("]")
+	return sb.String()
+}
@@ -0,0 +1,165 @@
+package log_test
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	LU "github.com/fbaube/logutils"
+	log "github.com/fbaube/mlog"
+)
+
+func newTestSyslogTarget(network, address string) *log.SyslogTarget {
+	target := log.NewSyslogTarget()
+	target.Network = network
+	target.Address = address
+	target.Facility = 16 // local0
+	target.Hostname = "host1"
+	target.AppName = "app 1"
+	target.ProcID = "42"
+	return target
+}
+
+// readDatagrams reads n datagrams from a packet connection.
+func readDatagrams(t *testing.T, conn net.PacketConn, n int) []string {
+	var messages []string
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for len(messages) < n {
+		m, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			t.Fatalf("ReadFrom(): %v", err)
+		}
+		messages = append(messages, string(buf[:m]))
+	}
+	return messages
+}
+
+func TestSyslogTargetUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger := log.NewLogger()
+	target := newTestSyslogTarget("udp", conn.LocalAddr().String())
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.GetLogger("db").With("id", 7, "q", `a "b"]`).Warning("t1")
+	logger.Log(LU.LevelDbg, "t2")
+	logger.Close()
+
+	messages := readDatagrams(t, conn, 2)
+	// local0 (16) * 8 + warning (4) = 132
+	re := regexp.MustCompile(`^<132>1 \d{4}-\d\d-\d\dT\d\d:\d\d:\d\d\.\d{6}(Z|[+-]\d\d:\d\d) ` +
+		`host1 app_1 42 db \[mlog@32473 id="7" q="a \\"b\\"\\]"\] t1$`)
+	if !re.MatchString(messages[0]) {
+		t.Errorf("messages[0] = %q", messages[0])
+	}
+	// LevelDbg is debug (7) too; there is no category or field.
+	if !strings.HasPrefix(messages[1], "<135>1 ") ||
+		!strings.HasSuffix(messages[1], " host1 app_1 42 - - t2") {
+		t.Errorf("messages[1] = %q", messages[1])
+	}
+}
+
+func TestSyslogTargetRFC3164(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger := log.NewLogger()
+	target := newTestSyslogTarget("udp", conn.LocalAddr().String())
+	target.RFC3164 = true
+	target.Facility = 1
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Error("t1")
+	logger.Close()
+
+	messages := readDatagrams(t, conn, 1)
+	re := regexp.MustCompile(`^<11>[A-Z][a-z]{2} [ 1-3]\d \d\d:\d\d:\d\d host1 app_1\[42\]: t1$`)
+	if !re.MatchString(messages[0]) {
+		t.Errorf("messages[0] = %q", messages[0])
+	}
+}
+
+func TestSyslogTargetCallStack(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	logger := log.NewLogger()
+	logger.CallStackDepth = 1
+	target := newTestSyslogTarget("udp", conn.LocalAddr().String())
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Error("t1")
+	logger.Close()
+
+	messages := readDatagrams(t, conn, 1)
+	if !strings.Contains(messages[0], " t1\n") || !strings.Contains(messages[0], "syslog_test.go:") ||
+		strings.Contains(messages[0], "\n\n") {
+		t.Errorf("messages[0] = %q, expected the call stack on the next line", messages[0])
+	}
+}
+
+func TestSyslogTargetTCP(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+	received := make(chan []string)
+	go func() {
+		var messages []string
+		conn, err := listener.Accept()
+		if err == nil {
+			// octet counting: "LEN SP MSG"
+			r := bufio.NewReader(conn)
+			for {
+				prefix, err := r.ReadString(' ')
+				if err != nil {
+					break
+				}
+				n, _ := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+				msg := make([]byte, n)
+				if _, err := io.ReadFull(r, msg); err != nil {
+					break
+				}
+				messages = append(messages, string(msg))
+			}
+			conn.Close()
+		}
+		received <- messages
+	}()
+
+	logger := log.NewLogger()
+	target := newTestSyslogTarget("tcp", listener.Addr().String())
+	logger.Targets = append(logger.Targets, target)
+	logger.Open()
+	logger.Info("t1\nt1")
+	logger.Info("t2")
+	logger.Close()
+
+	messages := <-received
+	if len(messages) != 2 {
+		t.Fatalf("got %d messages, expected 2: %q", len(messages), messages)
+	}
+	if !strings.HasPrefix(messages[0], "<134>1 ") || !strings.HasSuffix(messages[0], " 42 - - t1\nt1") {
+		t.Errorf("messages[0] = %q", messages[0])
+	}
+	if !strings.HasSuffix(messages[1], " 42 - - t2") {
+		t.Errorf("messages[1] = %q", messages[1])
+	}
+}